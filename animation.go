@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const ANIMATION_FPS float64 = 30
+const ANIMATION_KEYFRAME_INTERVAL = 2 * time.Second
+const ANSI_WIDTH int = 80
+const ANSI_HEIGHT int = 25
+
+// Emulated connection speed for .ans files, 0 shows the whole file at once
+var ANSI_BAUD_RATE int = 28800
+
+type AnimationEvent struct {
+	time time.Duration
+	data string
+}
+
+// Screen state before the event at index event is applied
+type AnimationKeyframe struct {
+	event  int
+	screen *VirtualScreen
+}
+
+type Animation struct {
+	filepath  string
+	width     int
+	height    int
+	duration  time.Duration
+	events    []AnimationEvent
+	keyframes []AnimationKeyframe
+	screen    *VirtualScreen
+	nextEvent int
+}
+
+var CURRENT_ANIMATION *Animation
+
+func isAnimation(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	return extension == ".cast" || extension == ".ans"
+}
+
+func loadAnimation(path string) (*Animation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	animation := &Animation{filepath: path}
+	if strings.ToLower(filepath.Ext(path)) == ".ans" {
+		loadAnsi(animation, data)
+	} else if err := loadAsciicast(animation, data); err != nil {
+		return nil, err
+	}
+	if animation.width < 1 || animation.height < 1 {
+		return nil, errors.New("invalid screen dimensions")
+	}
+	if len(animation.events) > 0 {
+		animation.duration = animation.events[len(animation.events)-1].time
+	}
+
+	buildKeyframes(animation)
+	return animation, nil
+}
+
+// Reads asciicast v1 (single JSON object) and v2 (header line followed by event lines) recordings
+func loadAsciicast(animation *Animation, data []byte) error {
+	var header struct {
+		Version  int             `json:"version"`
+		Width    int             `json:"width"`
+		Height   int             `json:"height"`
+		Stdout   [][]interface{} `json:"stdout"`
+		Duration float64         `json:"duration"`
+	}
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	if err := json.Unmarshal(firstLine, &header); err != nil || header.Version != 2 {
+		// v1 recordings are a single JSON document
+		if err := json.Unmarshal(data, &header); err != nil {
+			return fmt.Errorf("invalid asciicast file: %v", err)
+		}
+	}
+	animation.width = header.Width
+	animation.height = header.Height
+
+	switch header.Version {
+	case 1:
+		var elapsed float64
+		for _, event := range header.Stdout {
+			if len(event) < 2 {
+				continue
+			}
+			delay, _ := event[0].(float64)
+			output, _ := event[1].(string)
+			elapsed += delay
+			animation.events = append(animation.events, AnimationEvent{secondsToDuration(elapsed), output})
+		}
+	case 2:
+		scanner := bufio.NewScanner(bytes.NewReader(data[len(firstLine):]))
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var event []interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) < 3 {
+				continue
+			}
+			seconds, _ := event[0].(float64)
+			eventType, _ := event[1].(string)
+			output, _ := event[2].(string)
+			// only output events change the screen
+			if eventType != "o" {
+				continue
+			}
+			animation.events = append(animation.events, AnimationEvent{secondsToDuration(seconds), output})
+		}
+	default:
+		return fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+
+	sort.SliceStable(animation.events, func(i, j int) bool {
+		return animation.events[i].time < animation.events[j].time
+	})
+	return nil
+}
+
+// Splits a .ans file into events at the emulated baud rate
+func loadAnsi(animation *Animation, data []byte) {
+	// everything after the end of file character is SAUCE metadata
+	if end := bytes.IndexByte(data, 0x1A); end >= 0 {
+		data = data[:end]
+	}
+	animation.width = ANSI_WIDTH
+	animation.height = ANSI_HEIGHT
+
+	if ANSI_BAUD_RATE <= 0 {
+		animation.events = []AnimationEvent{{0, string(data)}}
+		return
+	}
+	// 10 bits per transferred byte
+	bytesPerFrame := max(int(float64(ANSI_BAUD_RATE)/10/ANIMATION_FPS), 1)
+	for frame := 0; frame*bytesPerFrame < len(data); frame++ {
+		chunk := data[frame*bytesPerFrame : min((frame+1)*bytesPerFrame, len(data))]
+		animation.events = append(animation.events, AnimationEvent{frameToDuration(frame), string(chunk)})
+	}
+}
+
+// Snapshots the screen every ANIMATION_KEYFRAME_INTERVAL so seeking doesn't replay from the start
+func buildKeyframes(animation *Animation) {
+	screen := newVirtualScreen(animation.width, animation.height)
+	animation.keyframes = []AnimationKeyframe{{0, screen.copy()}}
+	nextKeyframe := ANIMATION_KEYFRAME_INTERVAL
+
+	for i, event := range animation.events {
+		if event.time >= nextKeyframe {
+			animation.keyframes = append(animation.keyframes, AnimationKeyframe{i, screen.copy()})
+			for nextKeyframe <= event.time {
+				nextKeyframe += ANIMATION_KEYFRAME_INTERVAL
+			}
+		}
+		screen.write(event.data)
+	}
+	animation.screen = newVirtualScreen(animation.width, animation.height)
+}
+
+// Restores the closest keyframe before the position and applies the remaining events
+func seekAnimation(animation *Animation, position time.Duration) {
+	i := sort.Search(len(animation.keyframes), func(i int) bool {
+		keyframe := animation.keyframes[i]
+		return keyframe.event < len(animation.events) && animation.events[keyframe.event].time > position
+	})
+	keyframe := animation.keyframes[max(i-1, 0)]
+	animation.screen = keyframe.screen.copy()
+	animation.nextEvent = keyframe.event
+	advanceAnimation(animation, position)
+}
+
+// Applies all events up to and including the position
+func advanceAnimation(animation *Animation, position time.Duration) {
+	for animation.nextEvent < len(animation.events) && animation.events[animation.nextEvent].time <= position {
+		animation.screen.write(animation.events[animation.nextEvent].data)
+		animation.nextEvent++
+	}
+}
+
+// Describes the animation as a video, so menus and seek targets work in frames
+func animationVideo(animation *Animation) Video {
+	return Video{
+		filepath:    animation.filepath,
+		duration:    animation.duration,
+		width:       animation.width,
+		height:      animation.height,
+		fps:         ANIMATION_FPS,
+		totalFrames: int(animation.duration.Seconds()*ANIMATION_FPS) + 1,
+	}
+}
+
+func frameToDuration(frame int) time.Duration {
+	return secondsToDuration(float64(frame) / ANIMATION_FPS)
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func playAnimation() {
+	animation := CURRENT_ANIMATION
+	timeline := PLAYBACK.(*Timeline)
+	seekAnimation(animation, frameToDuration(timeline.CurrentFrame()))
+	setTerminalDimensions()
+	startInput()
+	PLAYING = true
+	runHook("start")
+
+	var shownRows []string
+	FULL_REDRAW = true
+
+	for PLAYING && !QUIT {
+		startFrameTime := time.Now()
+		dimChanged := setTerminalDimensions()
+		if handlePlaybackEvents() {
+			seekAnimation(animation, frameToDuration(timeline.CurrentFrame()))
+		}
+		if !timeline.Paused() {
+			advanceAnimation(animation, frameToDuration(timeline.CurrentFrame()))
+			timeline.Advance()
+		}
+		shownRows = drawAnimation(animation, shownRows, dimChanged || FULL_REDRAW || FULL_FRAMES)
+		FULL_REDRAW = false
+
+		drawMenu()
+		handleAnimationSnapshot()
+		handleIpcEvents()
+		handleHistory()
+
+		waitForNextFrame(startFrameTime)
+		if timeline.CurrentFrame() >= END_FRAME {
+			PLAYING = false
+		}
+	}
+	exit()
+}
+
+// Draws the rows of the virtual screen that changed since they were last drawn
+func drawAnimation(animation *Animation, shownRows []string, full bool) []string {
+	rows := min(animation.screen.height, TERMINAL_HEIGHT-3)
+	output := ""
+	if full {
+		output += "\033[2J" + gotoCharacter(0, 0) + HELP_MENU
+		shownRows = nil
+	}
+	newRows := make([]string, rows)
+	for row := 0; row < rows; row++ {
+		newRows[row] = animation.screen.renderRow(row, TERMINAL_WIDTH)
+		if row < len(shownRows) && shownRows[row] == newRows[row] {
+			continue
+		}
+		output += gotoCharacter(0, row+1) + newRows[row] + "\033[K"
+	}
+	fmt.Print(output)
+	return newRows
+}
+
+func handleAnimationSnapshot() {
+	if SNAPSHOT {
+		setStatusMessage("Snapshots are not supported for animations")
+		SNAPSHOT = false
+	}
+}
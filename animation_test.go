@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadAsciicast(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		width   int
+		height  int
+		events  []AnimationEvent
+		wantErr bool
+	}{
+		{
+			"version 1 has delays between events",
+			`{"version": 1, "width": 20, "height": 5, "duration": 1.5, "stdout": [[0.5, "a"], [0.25, "b\r\n"], [0.75, "c"], ["invalid"]]}`,
+			20, 5,
+			[]AnimationEvent{{500 * time.Millisecond, "a"}, {750 * time.Millisecond, "b\r\n"}, {1500 * time.Millisecond, "c"}},
+			false,
+		},
+		{
+			"version 1 over several lines",
+			"{\n  \"version\": 1,\n  \"width\": 20,\n  \"height\": 5,\n  \"stdout\": [[1, \"a\"]]\n}",
+			20, 5,
+			[]AnimationEvent{{time.Second, "a"}},
+			false,
+		},
+		{
+			"version 2 has timestamps",
+			`{"version": 2, "width": 80, "height": 24, "timestamp": 1700000000, "env": {"TERM": "xterm"}}
+[0.5, "o", "a"]
+[0.7, "i", "typed"]
+[1.0, "r", "100x30"]
+[1.25, "o", "b"]
+
+not json
+[2]
+[2.5, "o", "c"]
+`,
+			80, 24,
+			[]AnimationEvent{{500 * time.Millisecond, "a"}, {1250 * time.Millisecond, "b"}, {2500 * time.Millisecond, "c"}},
+			false,
+		},
+		{
+			"version 2 events out of order",
+			"{\"version\": 2, \"width\": 10, \"height\": 2}\n[2, \"o\", \"b\"]\n[1, \"o\", \"a\"]\n[2, \"o\", \"c\"]",
+			10, 2,
+			[]AnimationEvent{{time.Second, "a"}, {2 * time.Second, "b"}, {2 * time.Second, "c"}},
+			false,
+		},
+		{"unsupported version", `{"version": 3, "term": {"cols": 80, "rows": 24}}`, 0, 0, nil, true},
+		{"not json", "hello", 0, 0, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			animation := &Animation{}
+			err := loadAsciicast(animation, []byte(test.data))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("loadAsciicast returned %v, want an error: %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if animation.width != test.width || animation.height != test.height {
+				t.Errorf("size is %dx%d, want %dx%d", animation.width, animation.height, test.width, test.height)
+			}
+			if !slices.Equal(animation.events, test.events) {
+				t.Errorf("events are %v, want %v", animation.events, test.events)
+			}
+		})
+	}
+}
+
+func TestLoadAnsi(t *testing.T) {
+	defer func(baudRate int) { ANSI_BAUD_RATE = baudRate }(ANSI_BAUD_RATE)
+	art := strings.Repeat("x", 200)
+	data := []byte(art + "\x1aSAUCE00 metadata")
+
+	ANSI_BAUD_RATE = 28800
+	animation := &Animation{}
+	loadAnsi(animation, data)
+	if animation.width != ANSI_WIDTH || animation.height != ANSI_HEIGHT {
+		t.Errorf("size is %dx%d, want %dx%d", animation.width, animation.height, ANSI_WIDTH, ANSI_HEIGHT)
+	}
+	// 28800 baud are 96 bytes per frame
+	want := []AnimationEvent{{0, art[:96]}, {frameToDuration(1), art[96:192]}, {frameToDuration(2), art[192:]}}
+	if !slices.Equal(animation.events, want) {
+		t.Errorf("events are %v, want %v", animation.events, want)
+	}
+
+	ANSI_BAUD_RATE = 0
+	animation = &Animation{}
+	loadAnsi(animation, data)
+	if want := []AnimationEvent{{0, art}}; !slices.Equal(animation.events, want) {
+		t.Errorf("without a baud rate the events are %v, want %v", animation.events, want)
+	}
+}
+
+// Replays the events up to the position on a new screen
+func replayAnimation(animation *Animation, position time.Duration) *VirtualScreen {
+	screen := newVirtualScreen(animation.width, animation.height)
+	for _, event := range animation.events {
+		if event.time > position {
+			break
+		}
+		screen.write(event.data)
+	}
+	return screen
+}
+
+func TestSeekAnimation(t *testing.T) {
+	animation := &Animation{width: 12, height: 4}
+	// ten seconds of a counter that moves, changes color and clears the screen now and then
+	for i := 0; i < 40; i++ {
+		data := fmt.Sprintf("\033[%d;%dH\033[3%dm%d", i%4+1, i%5+1, i%8, i)
+		if i%7 == 6 {
+			data = "\033[2J" + data
+		}
+		if i%3 == 0 {
+			data += "\r\n"
+		}
+		animation.events = append(animation.events, AnimationEvent{time.Duration(i) * 250 * time.Millisecond, data})
+	}
+	animation.duration = animation.events[len(animation.events)-1].time
+	buildKeyframes(animation)
+	if len(animation.keyframes) < 5 {
+		t.Fatalf("built %d keyframes for ten seconds, want at least 5", len(animation.keyframes))
+	}
+
+	// backwards after forwards, so seeks don't depend on the previous position
+	positions := []time.Duration{0, 100 * time.Millisecond, 2 * time.Second, 1999 * time.Millisecond, 5250 * time.Millisecond, 9750 * time.Millisecond, time.Minute, 3 * time.Second, 0}
+	for _, position := range positions {
+		seekAnimation(animation, position)
+		want := replayAnimation(animation, position)
+		if !slices.Equal(animation.screen.cells, want.cells) {
+			t.Errorf("screen after seeking to %v is\n%s\nwant\n%s", position,
+				strings.Join(screenRows(animation.screen), "\n"), strings.Join(screenRows(want), "\n"))
+		}
+		if animation.screen.cursorX != want.cursorX || animation.screen.cursorY != want.cursorY || animation.screen.style != want.style {
+			t.Errorf("cursor after seeking to %v is different from replaying", position)
+		}
+	}
+
+	// playing on after a seek continues like the replay
+	seekAnimation(animation, 4*time.Second)
+	advanceAnimation(animation, 6*time.Second)
+	if want := replayAnimation(animation, 6*time.Second); !slices.Equal(animation.screen.cells, want.cells) {
+		t.Error("the screen after seeking and advancing is different from replaying")
+	}
+}
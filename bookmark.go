@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cli-video-player/media"
+)
+
+const BOOKMARKS_FILE = "bookmarks.json"
+const BOOKMARK_PROMPT_TEXT = "bookmark name: "
+
+// Jumping back from just after a bookmark goes to the one before it, like skipping chapters
+const BOOKMARK_BACK_MARGIN float64 = 2
+
+type Bookmark struct {
+	Position float64 `json:"position"`
+	Name     string  `json:"name,omitempty"`
+}
+
+// Bookmarks of one file, sorted by position. This is also the JSON export format.
+type BookmarkList struct {
+	Path      string     `json:"path"`
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+// Bookmarks are kept per file under the same key as resume positions
+type BookmarkState struct {
+	Files map[string]BookmarkList `json:"files"`
+}
+
+// Bookmarks of CURRENT_VIDEO, BOOKMARKS_KEY is empty when it can't have any
+var BOOKMARKS []Bookmark
+var BOOKMARKS_KEY string = ""
+
+var BOOKMARK_PROMPT bool = false
+var BOOKMARK_INPUT string = ""
+
+// index of the bookmark being named
+var BOOKMARK_NAMING int = -1
+
+func readBookmarkState() BookmarkState {
+	state := BookmarkState{}
+	readStateFile(BOOKMARKS_FILE, &state)
+	if state.Files == nil {
+		state.Files = map[string]BookmarkList{}
+	}
+	return state
+}
+
+func loadBookmarks(video *Video) {
+	BOOKMARKS = nil
+	BOOKMARKS_KEY = ""
+	key, ok := positionKey(video.filepath)
+	if !ok || video.stream != nil || video.totalFrames == 0 {
+		return
+	}
+	BOOKMARKS_KEY = key
+	BOOKMARKS = readBookmarkState().Files[key].Bookmarks
+}
+
+func saveBookmarks(key string, path string, bookmarks []Bookmark) error {
+	// read again right before writing, other players could have saved in the meantime
+	state := readBookmarkState()
+	if len(bookmarks) == 0 {
+		delete(state.Files, key)
+	} else {
+		state.Files[key] = BookmarkList{Path: path, Bookmarks: bookmarks}
+	}
+	return writeStateFile(BOOKMARKS_FILE, state)
+}
+
+func sortBookmarks(bookmarks []Bookmark) {
+	sort.SliceStable(bookmarks, func(i, j int) bool {
+		return bookmarks[i].Position < bookmarks[j].Position
+	})
+}
+
+// Adds the bookmarks that aren't there yet, importing the same file twice changes nothing
+func mergeBookmarks(bookmarks []Bookmark, added []Bookmark) []Bookmark {
+	for _, bookmark := range added {
+		exists := false
+		for i := range bookmarks {
+			if math.Abs(bookmarks[i].Position-bookmark.Position) < 0.001 {
+				exists = true
+				if bookmarks[i].Name == "" {
+					bookmarks[i].Name = bookmark.Name
+				}
+			}
+		}
+		if !exists {
+			bookmarks = append(bookmarks, bookmark)
+		}
+	}
+	sortBookmarks(bookmarks)
+	return bookmarks
+}
+
+func bookmarkLabel(bookmark Bookmark) string {
+	if bookmark.Name == "" {
+		return "Bookmark at " + formatClock(bookmark.Position)
+	}
+	return bookmark.Name + " (" + formatClock(bookmark.Position) + ")"
+}
+
+// Drops a bookmark at the current frame and asks for its name
+func addBookmark() {
+	if BOOKMARKS_KEY == "" {
+		setStatusMessage("Bookmarks are only supported for video files")
+		return
+	}
+	frame := currentFrame()
+	position := float64(frame) / CURRENT_VIDEO.fps
+	for i, bookmark := range BOOKMARKS {
+		if int(bookmark.Position*CURRENT_VIDEO.fps) == frame {
+			// pressing the key again on a bookmark renames it
+			openBookmarkPrompt(i)
+			return
+		}
+	}
+	BOOKMARKS = append(BOOKMARKS, Bookmark{Position: position})
+	sortBookmarks(BOOKMARKS)
+	for i, bookmark := range BOOKMARKS {
+		if bookmark.Position == position {
+			openBookmarkPrompt(i)
+		}
+	}
+	if err := saveBookmarks(BOOKMARKS_KEY, CURRENT_VIDEO.filepath, BOOKMARKS); err != nil {
+		setStatusMessage("Could not save the bookmark: " + err.Error())
+	}
+}
+
+// Seeks to the next bookmark, or the previous one when direction is negative
+func jumpToBookmark(direction int) {
+	if len(BOOKMARKS) == 0 {
+		setStatusMessage("No bookmarks yet")
+		return
+	}
+	frame := currentFrame()
+	position := float64(frame) / CURRENT_VIDEO.fps
+	target := -1
+	if direction > 0 {
+		for i, bookmark := range BOOKMARKS {
+			if int(bookmark.Position*CURRENT_VIDEO.fps) > frame {
+				target = i
+				break
+			}
+		}
+	} else {
+		for i := len(BOOKMARKS) - 1; i >= 0; i-- {
+			if BOOKMARKS[i].Position < position-BOOKMARK_BACK_MARGIN {
+				target = i
+				break
+			}
+		}
+	}
+	if target < 0 {
+		setStatusMessage("No more bookmarks")
+		return
+	}
+	setStatusMessage(bookmarkLabel(BOOKMARKS[target]))
+	seekTo(int(BOOKMARKS[target].Position * CURRENT_VIDEO.fps))
+}
+
+// Handles a single key while the name prompt is open. Escape leaves the bookmark unnamed.
+func handleBookmarkPromptInput(key byte) {
+	switch key {
+	case 13, 10: // SUBMIT: enter
+		if BOOKMARK_NAMING >= 0 && BOOKMARK_NAMING < len(BOOKMARKS) {
+			BOOKMARKS[BOOKMARK_NAMING].Name = strings.TrimSpace(BOOKMARK_INPUT)
+			if err := saveBookmarks(BOOKMARKS_KEY, CURRENT_VIDEO.filepath, BOOKMARKS); err != nil {
+				setStatusMessage("Could not save the bookmark: " + err.Error())
+			} else {
+				setStatusMessage("Saved " + bookmarkLabel(BOOKMARKS[BOOKMARK_NAMING]))
+			}
+		}
+		closeBookmarkPrompt()
+	case 27: // CANCEL: escape
+		closeBookmarkPrompt()
+	default:
+		BOOKMARK_INPUT = editPromptInput(BOOKMARK_INPUT, key)
+	}
+}
+
+func openBookmarkPrompt(index int) {
+	BOOKMARK_PROMPT = true
+	BOOKMARK_NAMING = index
+	BOOKMARK_INPUT = BOOKMARKS[index].Name
+}
+
+func closeBookmarkPrompt() {
+	BOOKMARK_PROMPT = false
+	BOOKMARK_NAMING = -1
+	BOOKMARK_INPUT = ""
+}
+
+func drawBookmarkPrompt() string {
+	return YELLOW_COLOR + BOOKMARK_PROMPT_TEXT + RESET_COLOR + BOOKMARK_INPUT + "\033[K"
+}
+
+// Columns of the progress bar that have a bookmark
+func bookmarkColumns(barWidth int, runtime float64) map[int]bool {
+	columns := map[int]bool{}
+	if runtime <= 0 {
+		return columns
+	}
+	for _, bookmark := range BOOKMARKS {
+		columns[min(int(float64(barWidth)*bookmark.Position/runtime), barWidth-1)] = true
+	}
+	return columns
+}
+
+// Lists, exports and imports the bookmarks of a file
+func runBookmarks(args []string) {
+	flags := newFlagSet("bookmarks")
+	export := flags.String("export", "", "write the bookmarks to a file, .json or an ffmetadata chapters file for ffmpeg")
+	importPath := flags.String("import", "", "add the bookmarks of a .json or ffmetadata file")
+	remove := flags.Int("remove", 0, "remove the bookmark with the number shown in the list")
+	clearBookmarks := flags.Bool("clear", false, "remove all bookmarks")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return
+	}
+	if len(args) != 1 {
+		printUsageError(flags.Name(), "Expected one video, got", len(args), "arguments.")
+		return
+	}
+	path := args[0]
+	key, ok := positionKey(path)
+	if !ok {
+		printError("File '" + path + "' could not be found.")
+		return
+	}
+	bookmarks := readBookmarkState().Files[key].Bookmarks
+
+	switch {
+	case *importPath != "":
+		imported, err := importBookmarks(*importPath)
+		if err != nil {
+			printError("Could not import '"+*importPath+"':", err)
+			return
+		}
+		before := len(bookmarks)
+		bookmarks = mergeBookmarks(bookmarks, imported)
+		if err := saveBookmarks(key, path, bookmarks); err != nil {
+			printError("Could not save the bookmarks:", err)
+			return
+		}
+		fmt.Println(PREFIX, "Imported", len(bookmarks)-before, "new bookmarks.")
+	case *export != "":
+		if len(bookmarks) == 0 {
+			printError("'" + path + "' has no bookmarks.")
+			return
+		}
+		if err := exportBookmarks(*export, path, bookmarks); err != nil {
+			printError("Could not export the bookmarks:", err)
+			return
+		}
+		fmt.Println(PREFIX, "Exported", len(bookmarks), "bookmarks to '"+*export+"'.")
+	case *remove != 0:
+		if *remove < 1 || *remove > len(bookmarks) {
+			printError("There is no bookmark", *remove, "in '"+path+"'.")
+			return
+		}
+		removed := bookmarks[*remove-1]
+		bookmarks = append(bookmarks[:*remove-1], bookmarks[*remove:]...)
+		if err := saveBookmarks(key, path, bookmarks); err != nil {
+			printError("Could not save the bookmarks:", err)
+			return
+		}
+		fmt.Println(PREFIX, "Removed", bookmarkLabel(removed)+".")
+	case *clearBookmarks:
+		if err := saveBookmarks(key, path, nil); err != nil {
+			printError("Could not save the bookmarks:", err)
+			return
+		}
+		fmt.Println(PREFIX, "Removed", len(bookmarks), "bookmarks.")
+	default:
+		if len(bookmarks) == 0 {
+			fmt.Println(PREFIX, "'"+path+"' has no bookmarks, press "+strings.Join(KEY_NAMES["bookmark"], " or ")+" while playing to add one.")
+			return
+		}
+		for i, bookmark := range bookmarks {
+			fmt.Printf("%3d  %9s  %s\n", i+1, formatClock(bookmark.Position), bookmark.Name)
+		}
+	}
+}
+
+// The format is picked by extension, .json is JSON and everything else ffmetadata
+func exportBookmarks(output string, path string, bookmarks []Bookmark) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(output), ".json") {
+		data, _ = json.MarshalIndent(BookmarkList{Path: path, Bookmarks: bookmarks}, "", "  ")
+		data = append(data, '\n')
+	} else {
+		// chapters need an end, which is the next bookmark or the end of the video
+		duration := 0.0
+		if info, err := media.Probe(path); err == nil {
+			duration = info.Duration
+		}
+		data = []byte(formatFfmetadata(bookmarks, duration))
+	}
+	return os.WriteFile(output, data, 0o644)
+}
+
+func importBookmarks(input string) ([]Bookmark, error) {
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(string(data), ";FFMETADATA1") {
+		return parseFfmetadata(string(data))
+	}
+	var list BookmarkList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, errors.New("neither JSON bookmarks nor an ffmetadata file")
+	}
+	return list.Bookmarks, nil
+}
+
+// Writes the bookmarks as chapters in milliseconds, mux them back with
+// 'ffmpeg -i video.mp4 -i chapters.txt -map_metadata 1 -codec copy out.mp4'
+func formatFfmetadata(bookmarks []Bookmark, duration float64) string {
+	var builder strings.Builder
+	builder.WriteString(";FFMETADATA1\n")
+	for i, bookmark := range bookmarks {
+		end := math.Max(duration, bookmark.Position)
+		if i+1 < len(bookmarks) {
+			end = bookmarks[i+1].Position
+		}
+		title := bookmark.Name
+		if title == "" {
+			title = "Bookmark " + strconv.Itoa(i+1)
+		}
+		fmt.Fprintf(&builder, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			int64(bookmark.Position*1000), int64(end*1000), escapeFfmetadata(title))
+	}
+	return builder.String()
+}
+
+// '=', ';', '#', '\' and newlines are escaped with a backslash
+func escapeFfmetadata(value string) string {
+	var builder strings.Builder
+	for _, char := range value {
+		if strings.ContainsRune("=;#\\\n", char) {
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(char)
+	}
+	return builder.String()
+}
+
+// Reads the start and title of every chapter
+func parseFfmetadata(data string) ([]Bookmark, error) {
+	var bookmarks []Bookmark
+	var current *Bookmark
+	timebase := 1.0 / 1000
+	var start int64
+	finish := func() {
+		if current != nil {
+			current.Position = float64(start) * timebase
+			bookmarks = append(bookmarks, *current)
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// escaped newlines continue the value on the next line
+		for escapesLineBreak(line) && scanner.Scan() {
+			line = line[:len(line)-1] + "\n" + scanner.Text()
+		}
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			finish()
+			current = nil
+			if line == "[CHAPTER]" {
+				current = &Bookmark{}
+				timebase = 1.0 / 1000
+				start = 0
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		key, value := splitFfmetadataLine(line)
+		switch key {
+		case "TIMEBASE":
+			numerator, denominator, _ := strings.Cut(value, "/")
+			n, errN := strconv.ParseFloat(numerator, 64)
+			d, errD := strconv.ParseFloat(denominator, 64)
+			if errN != nil || errD != nil || d == 0 {
+				return nil, fmt.Errorf("invalid TIMEBASE '%s'", value)
+			}
+			timebase = n / d
+		case "START":
+			var err error
+			if start, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid START '%s'", value)
+			}
+		case "title":
+			current.Name = value
+		}
+	}
+	finish()
+	sortBookmarks(bookmarks)
+	return bookmarks, nil
+}
+
+// An odd number of backslashes at the end escapes the line break, an even number are escaped backslashes
+func escapesLineBreak(line string) bool {
+	backslashes := len(line) - len(strings.TrimRight(line, "\\"))
+	return backslashes%2 == 1
+}
+
+// Splits at the first unescaped '=' and removes the escaping
+func splitFfmetadataLine(line string) (string, string) {
+	var key, value strings.Builder
+	target := &key
+	escaped := false
+	for _, char := range line {
+		switch {
+		case escaped:
+			target.WriteRune(char)
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '=' && target == &key:
+			target = &value
+		default:
+			target.WriteRune(char)
+		}
+	}
+	return key.String(), value.String()
+}
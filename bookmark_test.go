@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFfmetadataRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+	}{
+		{"plain", "Intro"},
+		{"equals", "a=b"},
+		{"semicolon", "; not a comment"},
+		{"hash", "#1 scene"},
+		{"backslash", `C:\videos`},
+		{"trailing backslash", `ends with \`},
+		{"newline", "two\nlines"},
+		{"trailing newline", "line\n"},
+		{"backslash before newline", "a\\\nb"},
+		{"everything", "=;#\\\n=;#\\\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bookmarks := []Bookmark{{Position: 1.5, Name: test.title}, {Position: 30, Name: "after"}}
+			parsed, err := parseFfmetadata(formatFfmetadata(bookmarks, 60))
+			if err != nil {
+				t.Fatalf("parseFfmetadata: %v", err)
+			}
+			if !slices.Equal(parsed, bookmarks) {
+				t.Errorf("parsed %+v, want %+v", parsed, bookmarks)
+			}
+		})
+	}
+}
+
+func TestEscapeFfmetadata(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Intro", "Intro"},
+		{"a=b;c#d", `a\=b\;c\#d`},
+		{`a\b`, `a\\b`},
+		{"a\nb", "a\\\nb"},
+	}
+	for _, test := range tests {
+		if got := escapeFfmetadata(test.value); got != test.want {
+			t.Errorf("escapeFfmetadata(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseFfmetadata(t *testing.T) {
+	data := ";FFMETADATA1\ntitle=Movie\n\n[CHAPTER]\nTIMEBASE=1/10\nSTART=25\nEND=50\n# a comment\ntitle=Second\n\n" +
+		"[CHAPTER]\nSTART=1000\ntitle=First\n\n[STREAM]\ntitle=not a chapter\n"
+	bookmarks, err := parseFfmetadata(data)
+	if err != nil {
+		t.Fatalf("parseFfmetadata: %v", err)
+	}
+	want := []Bookmark{{Position: 1, Name: "First"}, {Position: 2.5, Name: "Second"}}
+	if !slices.Equal(bookmarks, want) {
+		t.Errorf("parsed %v, want %v", bookmarks, want)
+	}
+
+	for _, invalid := range []string{"[CHAPTER]\nTIMEBASE=1/0\n", "[CHAPTER]\nSTART=soon\n"} {
+		if _, err := parseFfmetadata(invalid); err == nil {
+			t.Errorf("parseFfmetadata(%q) succeeded", invalid)
+		}
+	}
+}
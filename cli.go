@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time with -ldflags "-X main.VERSION=1.2.3"
+var VERSION string = "dev"
+
+type Command struct {
+	name        string
+	arguments   string
+	description string
+	run         func(args []string)
+}
+
+// Subcommands are only recognized as the first argument, 'play ./info' plays a file named info
+func commands() []Command {
+	return []Command{
+		{"info", "[flags] <video_path>", "show the format, streams, chapters and tags of a file", runInfo},
+		{"render", "[flags] <video_path>", "render a video to an asciinema recording", runRender},
+		{"export", "[flags] <video_path>", "export a video as rendered ASCII to a GIF or video file", runExport},
+		{"serve", "[flags] <video_path>", "stream a video to telnet clients", runServe},
+		{"bench", "[flags] [video_path]", "measure how fast frames are decoded and drawn", runBench},
+		{"bookmarks", "[flags] <video_path>", "list, export and import the bookmarks of a video", runBookmarks},
+		{"history", "[flags]", "list recently played files", runHistory},
+		{"last", "[flags]", "play the most recently played file again, with the flags of playing", runLast},
+		{"config", "[flags]", "show the effective configuration, or where it is read from", runConfig},
+		{"version", "", "show the version of the player and of ffmpeg", runVersion},
+	}
+}
+
+func findCommand(name string) (Command, bool) {
+	for _, command := range commands() {
+		if command.name == name {
+			return command, true
+		}
+	}
+	return Command{}, false
+}
+
+// Creates the flags of a subcommand, or of playing when name is empty
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(strings.TrimSpace("play "+name), flag.ContinueOnError)
+	flags.Usage = func() {
+		if name == "" {
+			printPlayUsage(flags)
+			return
+		}
+		command, _ := findCommand(name)
+		fmt.Println("Usage: play", strings.TrimSpace(command.name+" "+command.arguments))
+		fmt.Println()
+		fmt.Println(strings.ToUpper(command.description[:1]) + command.description[1:] + ".")
+		printFlags(flags)
+	}
+	return flags
+}
+
+func printPlayUsage(flags *flag.FlagSet) {
+	fmt.Println("Usage: play [flags] <path>...")
+	fmt.Println("       play <command> [flags] [arguments]")
+	fmt.Println()
+	fmt.Println("Plays videos, urls, images, directories of images and .ans animations in the terminal.")
+	fmt.Println("Several videos are played one after another, '-' reads a video from stdin.")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, command := range commands() {
+		fmt.Printf("  %-9s %s\n", command.name, command.description)
+	}
+	printFlags(flags)
+	fmt.Println()
+	fmt.Println("Run 'play <command> --help' for the flags of a command.")
+}
+
+func printFlags(flags *flag.FlagSet) {
+	hasFlags := false
+	flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if !hasFlags {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Flags:")
+	flags.SetOutput(os.Stdout)
+	flags.PrintDefaults()
+	flags.SetOutput(io.Discard)
+}
+
+// Parses flags anywhere between the arguments, so 'play video.mp4 --start 1:00' works like
+// 'play --start 1:00 video.mp4'. Everything after '--' is an argument.
+// Returns false when the command should not run, after the usage or an error was printed.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, bool) {
+	// the flag package would print the usage on every error
+	usage := flags.Usage
+	flags.Usage = func() {}
+	defer func() { flags.Usage = usage }()
+	flags.SetOutput(io.Discard)
+	var arguments []string
+	for {
+		err := flags.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			usage()
+			return nil, false
+		}
+		if err != nil {
+			printUsageError(flags.Name(), err.Error()+".")
+			return nil, false
+		}
+		rest := flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		// Parse stops at the first argument, or after consuming '--'
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			arguments = append(arguments, rest...)
+			break
+		}
+		arguments = append(arguments, rest[0])
+		args = rest[1:]
+	}
+	return arguments, true
+}
+
+func printError(a ...any) {
+	fmt.Println(append([]any{PREFIX}, a...)...)
+	EXIT_CODE = 1
+}
+
+// Reports a wrong invocation, with a pointer to the help of the command
+func printUsageError(command string, a ...any) {
+	printError(a...)
+	fmt.Println(strings.Repeat(" ", len(PREFIX_TEXT)), "Run '"+command+" --help' for usage.")
+	EXIT_CODE = 2
+}
+
+func runVersion(args []string) {
+	flags := newFlagSet("version")
+	if _, ok := parseFlags(flags, args); !ok {
+		return
+	}
+	version := VERSION
+	// builds with 'go install' know their module version
+	if info, ok := debug.ReadBuildInfo(); ok && version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	fmt.Printf("cli-video-player %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	output, err := exec.Command("ffmpeg", "-version").Output()
+	if err != nil {
+		fmt.Println("ffmpeg not found, it is needed to play videos")
+		return
+	}
+	fmt.Println(strings.SplitN(string(output), "\n", 2)[0])
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"cli-video-player/render"
+	"github.com/BurntSushi/toml"
+)
+
+const CONFIG_NAME = "cli-video-player"
+const CONFIG_ENV_PREFIX = "CLI_VIDEO_PLAYER_"
+
+// Every setting can be set in the config file, and overridden by an environment variable
+// named after its section and key, e.g. CLI_VIDEO_PLAYER_RENDERER_GAMMA. Command line flags
+// take precedence over both.
+type Config struct {
+	Renderer  RendererConfig  `toml:"renderer"`
+	Colors    ColorConfig     `toml:"colors"`
+	Keys      KeyConfig       `toml:"keys"`
+	Seek      SeekConfig      `toml:"seek"`
+	Buffer    BufferConfig    `toml:"buffer"`
+	Audio     AudioConfig     `toml:"audio"`
+	Snapshot  SnapshotConfig  `toml:"snapshot"`
+	Animation AnimationConfig `toml:"animation"`
+	Slideshow SlideshowConfig `toml:"slideshow"`
+	History   HistoryConfig   `toml:"history"`
+	Hooks     HooksConfig     `toml:"hooks"`
+}
+
+type RendererConfig struct {
+	Gamma      float64 `toml:"gamma"`
+	Ramp       string  `toml:"ramp"`
+	FullFrames bool    `toml:"full_frames"`
+}
+
+// Colors are names (red, yellow, ...), 256 color numbers or #rrggbb
+type ColorConfig struct {
+	Accent    string `toml:"accent"`
+	Frame     string `toml:"frame"`
+	Text      string `toml:"text"`
+	Highlight string `toml:"highlight"`
+	Error     string `toml:"error"`
+}
+
+// Keys are single characters, "space" or "ctrl-<letter>". 0-9 and ctrl-c can't be rebound.
+type KeyConfig struct {
+	Quit             []string `toml:"quit"`
+	Pause            []string `toml:"pause"`
+	Back             []string `toml:"back"`
+	Forward          []string `toml:"forward"`
+	Seek             []string `toml:"seek"`
+	Reverse          []string `toml:"reverse"`
+	Snapshot         []string `toml:"snapshot"`
+	Bookmark         []string `toml:"bookmark"`
+	NextBookmark     []string `toml:"next_bookmark"`
+	PreviousBookmark []string `toml:"previous_bookmark"`
+}
+
+type SeekConfig struct {
+	SkipSeconds int `toml:"skip_seconds"`
+}
+
+type BufferConfig struct {
+	Size   int `toml:"size"`
+	Offset int `toml:"offset"`
+}
+
+type AudioConfig struct {
+	Export bool `toml:"export"`
+}
+
+type SnapshotConfig struct {
+	Dir string `toml:"dir"`
+}
+
+type AnimationConfig struct {
+	Baud int `toml:"baud"`
+}
+
+type SlideshowConfig struct {
+	Interval string `toml:"interval"`
+}
+
+// Shell commands run in the background on playback events, killed after the timeout.
+// They get CLI_VIDEO_PLAYER_EVENT, _FILE, _POSITION, _FRAME, _DURATION, _STATE and _PID.
+type HooksConfig struct {
+	OnStart  string `toml:"on_start"`
+	OnPause  string `toml:"on_pause"`
+	OnResume string `toml:"on_resume"`
+	OnSeek   string `toml:"on_seek"`
+	OnEnd    string `toml:"on_end"`
+	OnQuit   string `toml:"on_quit"`
+	Timeout  string `toml:"timeout"`
+}
+
+// Entries beyond max_entries or older than max_age_days are dropped, 0 days keeps them forever
+type HistoryConfig struct {
+	Enabled    bool `toml:"enabled"`
+	MaxEntries int  `toml:"max_entries"`
+	MaxAgeDays int  `toml:"max_age_days"`
+}
+
+var COLOR_NAMES = map[string]int{
+	"black": 30, "red": 31, "green": 32, "yellow": 33, "blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+}
+
+var KEY_ACTIONS = []string{"quit", "pause", "back", "forward", "seek", "reverse", "snapshot", "bookmark", "next_bookmark", "previous_bookmark"}
+
+// Keys mapped to the action they trigger in handleKey
+var KEYBINDINGS = map[byte]string{}
+var KEY_NAMES = map[string][]string{}
+var EXPORT_AUDIO bool = true
+
+func defaultConfig() Config {
+	return Config{
+		Renderer: RendererConfig{Gamma: render.DEFAULT_GAMMA, Ramp: render.DEFAULT_CHARACTERS},
+		Colors:   ColorConfig{Accent: "yellow", Frame: "blue", Text: "cyan", Highlight: "208", Error: "red"},
+		Keys: KeyConfig{
+			Quit:             []string{"q"},
+			Pause:            []string{"space", "k"},
+			Back:             []string{"j", "<"},
+			Forward:          []string{"l", ">"},
+			Seek:             []string{"g"},
+			Reverse:          []string{"r"},
+			Snapshot:         []string{"s"},
+			Bookmark:         []string{"m"},
+			NextBookmark:     []string{"]"},
+			PreviousBookmark: []string{"["},
+		},
+		Seek:      SeekConfig{SkipSeconds: 10},
+		Buffer:    BufferConfig{Size: 15, Offset: 30},
+		Audio:     AudioConfig{Export: true},
+		Snapshot:  SnapshotConfig{Dir: "."},
+		Animation: AnimationConfig{Baud: 28800},
+		Slideshow: SlideshowConfig{Interval: "5s"},
+		History:   HistoryConfig{Enabled: true, MaxEntries: 1000},
+		Hooks:     HooksConfig{Timeout: "10s"},
+	}
+}
+
+func configPath() string {
+	if path := os.Getenv(CONFIG_ENV_PREFIX + "CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, CONFIG_NAME, "config.toml")
+}
+
+// Layers the config file and the environment over the built-in defaults.
+// A missing config file is not an error.
+func loadConfig(path string) (Config, error) {
+	config := defaultConfig()
+	if path != "" {
+		metadata, err := toml.DecodeFile(path, &config)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return defaultConfig(), err
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return defaultConfig(), fmt.Errorf("unknown setting '%s'", undecoded[0])
+		}
+	}
+	if err := applyEnvironment(&config); err != nil {
+		return defaultConfig(), err
+	}
+	if err := validateConfig(config); err != nil {
+		return defaultConfig(), err
+	}
+	return config, nil
+}
+
+// Overrides settings with CLI_VIDEO_PLAYER_<SECTION>_<KEY> environment variables.
+// Lists are separated by commas, spaces around the items are ignored.
+func applyEnvironment(config *Config) error {
+	sections := reflect.ValueOf(config).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Tag.Get("toml")
+		for j := 0; j < section.NumField(); j++ {
+			key := section.Type().Field(j).Tag.Get("toml")
+			name := CONFIG_ENV_PREFIX + strings.ToUpper(sectionName+"_"+key)
+			value, exists := os.LookupEnv(name)
+			if !exists {
+				continue
+			}
+			field := section.Field(j)
+			var err error
+			switch field.Kind() {
+			case reflect.String:
+				field.SetString(value)
+			case reflect.Int:
+				var number int
+				number, err = strconv.Atoi(value)
+				field.SetInt(int64(number))
+			case reflect.Float64:
+				var number float64
+				number, err = strconv.ParseFloat(value, 64)
+				field.SetFloat(number)
+			case reflect.Bool:
+				var boolean bool
+				boolean, err = strconv.ParseBool(value)
+				field.SetBool(boolean)
+			case reflect.Slice:
+				items := strings.Split(value, ",")
+				for k := range items {
+					items[k] = strings.TrimSpace(items[k])
+				}
+				field.Set(reflect.ValueOf(items))
+			}
+			if err != nil {
+				return fmt.Errorf("invalid %s: '%s'", name, value)
+			}
+		}
+	}
+	return nil
+}
+
+func validateConfig(config Config) error {
+	if config.Renderer.Gamma <= 0 {
+		return errors.New("renderer.gamma has to be above 0")
+	}
+	if len(config.Renderer.Ramp) < 2 {
+		return errors.New("renderer.ramp needs at least 2 characters")
+	}
+	// frames are indexed by byte
+	for _, char := range config.Renderer.Ramp {
+		if char < 32 || char > 126 {
+			return errors.New("renderer.ramp can only contain printable ASCII characters")
+		}
+	}
+	colors := map[string]string{
+		"accent":    config.Colors.Accent,
+		"frame":     config.Colors.Frame,
+		"text":      config.Colors.Text,
+		"highlight": config.Colors.Highlight,
+		"error":     config.Colors.Error,
+	}
+	for name, value := range colors {
+		if _, err := parseTerminalColor(value); err != nil {
+			return fmt.Errorf("colors.%s: %v", name, err)
+		}
+	}
+	if _, err := parseKeybindings(config.Keys); err != nil {
+		return err
+	}
+	if config.Seek.SkipSeconds < 1 {
+		return errors.New("seek.skip_seconds has to be at least 1")
+	}
+	if config.Buffer.Size < 1 || config.Buffer.Offset < config.Buffer.Size {
+		return errors.New("buffer.size has to be at least 1 and buffer.offset at least buffer.size")
+	}
+	if config.Animation.Baud < 0 {
+		return errors.New("animation.baud can't be negative")
+	}
+	if interval, err := time.ParseDuration(config.Slideshow.Interval); err != nil || interval <= 0 {
+		return fmt.Errorf("slideshow.interval '%s' is not a duration like 5s", config.Slideshow.Interval)
+	}
+	if config.History.MaxEntries < 1 || config.History.MaxAgeDays < 0 {
+		return errors.New("history.max_entries has to be at least 1 and history.max_age_days can't be negative")
+	}
+	if timeout, err := time.ParseDuration(config.Hooks.Timeout); err != nil || timeout <= 0 {
+		return fmt.Errorf("hooks.timeout '%s' is not a duration like 10s", config.Hooks.Timeout)
+	}
+	return nil
+}
+
+// Sets the globals the rest of the player reads. The config has to be valid.
+func applyConfig(config Config) {
+	GAMMA = config.Renderer.Gamma
+	DEFAULT_ASCII = config.Renderer.Ramp
+	FULL_FRAMES = config.Renderer.FullFrames
+
+	YELLOW_COLOR, _ = parseTerminalColor(config.Colors.Accent)
+	BLUE_COLOR, _ = parseTerminalColor(config.Colors.Frame)
+	CYAN_COLOR, _ = parseTerminalColor(config.Colors.Text)
+	ORANGE_COLOR, _ = parseTerminalColor(config.Colors.Highlight)
+	RED_COLOR, _ = parseTerminalColor(config.Colors.Error)
+
+	KEYBINDINGS, _ = parseKeybindings(config.Keys)
+	KEY_NAMES = keyActions(config.Keys)
+
+	SKIP_AMOUNT_S = config.Seek.SkipSeconds
+	BUFFER_SIZE = config.Buffer.Size
+	BUFFER_OFFSET = config.Buffer.Offset
+	EXPORT_AUDIO = config.Audio.Export
+	SNAPSHOT_DIR = config.Snapshot.Dir
+	ANSI_BAUD_RATE = config.Animation.Baud
+	SLIDESHOW_INTERVAL, _ = time.ParseDuration(config.Slideshow.Interval)
+	HISTORY_ENABLED = config.History.Enabled
+	HISTORY_MAX_ENTRIES = config.History.MaxEntries
+	HISTORY_MAX_AGE = time.Duration(config.History.MaxAgeDays) * 24 * time.Hour
+	HOOKS = map[string]string{
+		"start":  config.Hooks.OnStart,
+		"pause":  config.Hooks.OnPause,
+		"resume": config.Hooks.OnResume,
+		"seek":   config.Hooks.OnSeek,
+		"end":    config.Hooks.OnEnd,
+		"quit":   config.Hooks.OnQuit,
+	}
+	HOOK_TIMEOUT, _ = time.ParseDuration(config.Hooks.Timeout)
+
+	buildMenuStrings()
+}
+
+func parseTerminalColor(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if code, exists := COLOR_NAMES[value]; exists {
+		return fmt.Sprintf("\033[%dm", code), nil
+	}
+	if strings.HasPrefix(value, "#") {
+		rgb, err := parseHexColor(value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("\033[38;2;%d;%d;%dm", rgb.R, rgb.G, rgb.B), nil
+	}
+	if number, err := strconv.Atoi(value); err == nil && number >= 0 && number <= 255 {
+		return fmt.Sprintf("\033[38;5;%dm", number), nil
+	}
+	return "", fmt.Errorf("'%s' is not a color name, 256 color number or #rrggbb", value)
+}
+
+func keyActions(keys KeyConfig) map[string][]string {
+	return map[string][]string{
+		"quit":              keys.Quit,
+		"pause":             keys.Pause,
+		"back":              keys.Back,
+		"forward":           keys.Forward,
+		"seek":              keys.Seek,
+		"reverse":           keys.Reverse,
+		"snapshot":          keys.Snapshot,
+		"bookmark":          keys.Bookmark,
+		"next_bookmark":     keys.NextBookmark,
+		"previous_bookmark": keys.PreviousBookmark,
+	}
+}
+
+func parseKeybindings(keys KeyConfig) (map[byte]string, error) {
+	actions := keyActions(keys)
+	bindings := map[byte]string{}
+	for _, action := range KEY_ACTIONS {
+		for _, name := range actions[action] {
+			key, err := parseKey(name)
+			if err != nil {
+				return nil, fmt.Errorf("keys.%s: %v", action, err)
+			}
+			if other, exists := bindings[key]; exists {
+				return nil, fmt.Errorf("keys.%s: '%s' is already used for %s", action, name, other)
+			}
+			bindings[key] = action
+		}
+	}
+	return bindings, nil
+}
+
+func parseKey(name string) (byte, error) {
+	switch {
+	case name == "space":
+		return 32, nil
+	case strings.HasPrefix(name, "ctrl-") && len(name) == 6 && name[5] >= 'a' && name[5] <= 'z':
+		if name[5] == 'c' {
+			return 0, errors.New("ctrl-c always quits")
+		}
+		return name[5] - 'a' + 1, nil
+	case len(name) == 1 && name[0] >= '0' && name[0] <= '9':
+		return 0, errors.New("0-9 are used for goto")
+	case len(name) == 1 && name[0] > 32 && name[0] < 127:
+		return name[0], nil
+	}
+	return 0, fmt.Errorf("'%s' is not a key", name)
+}
+
+func buildHelpMenu() string {
+	keys := func(action string) string {
+		names := make([]string, len(KEY_NAMES[action]))
+		for i, name := range KEY_NAMES[action] {
+			if name == "space" {
+				name = "spacebar"
+			}
+			names[i] = name
+		}
+		return "[" + strings.Join(names, ", ") + "]"
+	}
+	quit := "quit" + keys("quit")
+	if len(KEY_NAMES["quit"]) == 1 && KEY_NAMES["quit"][0] == "q" {
+		quit = "[q]uit"
+	}
+	return quit + "  pause" + keys("pause") + "  backwards" + keys("back") + "  forward" + keys("forward") +
+		"  goto[0-9]  seek" + keys("seek") + "  reverse" + keys("reverse") + "  snapshot" + keys("snapshot") +
+		"  bookmark" + keys("bookmark") + " " + strings.Join(KEY_NAMES["previous_bookmark"], ",") + "/" + strings.Join(KEY_NAMES["next_bookmark"], ",")
+}
+
+// Prints the effective configuration, or why the config file is invalid
+func runConfig(args []string) {
+	flags := newFlagSet("config")
+	printPath := flags.Bool("path", false, "only print where the config is read from")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return
+	}
+	if len(args) > 0 {
+		printUsageError(flags.Name(), "Unknown arguments:", strings.Join(args, " "))
+		return
+	}
+	path := configPath()
+	config, err := loadConfig(path)
+	if err != nil {
+		printError("Invalid config '"+path+"':", err)
+		return
+	}
+	if *printPath {
+		fmt.Println(path)
+		return
+	}
+	if _, err := os.Stat(path); err == nil {
+		fmt.Println("# " + path)
+	} else {
+		fmt.Println("# " + path + " (not found, showing defaults)")
+	}
+	encoder := toml.NewEncoder(os.Stdout)
+	encoder.Indent = ""
+	encoder.Encode(config)
+}
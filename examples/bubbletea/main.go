@@ -0,0 +1,98 @@
+// Plays a video in a pane of a Bubble Tea program: go run ./examples/bubbletea video.mp4
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"cli-video-player/player"
+	"cli-video-player/tui"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const SKIP_AMOUNT = 10 * time.Second
+
+type model struct {
+	video  tui.Model
+	status string
+}
+
+func (m model) Init() tea.Cmd {
+	return m.video.Init()
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			m.video.Close()
+			return m, tea.Quit
+		case " ":
+			return m.updateVideo(tui.TogglePauseMsg{})
+		case "left":
+			return m.updateVideo(tui.SkipMsg{Offset: -SKIP_AMOUNT})
+		case "right":
+			return m.updateVideo(tui.SkipMsg{Offset: SKIP_AMOUNT})
+		case "0":
+			return m.updateVideo(tui.SeekMsg{Position: 0})
+		}
+	case tea.WindowSizeMsg:
+		// the pane leaves room for the title and status lines
+		m.video.SetSize(msg.Width-4, msg.Height-4)
+	case tui.EventMsg:
+		m.status = msg.Event.Type
+		if msg.Event.Err != nil {
+			m.status += ": " + msg.Event.Err.Error()
+		}
+	}
+	return m.updateVideo(msg)
+}
+
+func (m model) updateVideo(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	m.video, cmd = m.video.Update(msg)
+	return m, cmd
+}
+
+func (m model) View() string {
+	videoPlayer := m.video.Player()
+	return fmt.Sprintf("  %s\n\n%s\n\n  %s / %s  %s  [space] pause  [left/right] skip  [0] restart  [q] quit",
+		videoPlayer.Info().Path, indent(m.video.View()),
+		formatPosition(videoPlayer.Position()), formatPosition(videoPlayer.Duration()), m.status)
+}
+
+func indent(view string) string {
+	indented := "  "
+	for _, char := range view {
+		indented += string(char)
+		if char == '\n' {
+			indented += "  "
+		}
+	}
+	return indented
+}
+
+func formatPosition(position time.Duration) string {
+	seconds := int(position.Seconds())
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Println("Usage: go run ./examples/bubbletea <video_path>")
+		os.Exit(2)
+	}
+	videoPlayer, err := player.Open(os.Args[1], player.Options{})
+	if err != nil {
+		fmt.Println("Could not open the video:", err)
+		os.Exit(1)
+	}
+	program := tea.NewProgram(model{video: tui.NewFromPlayer(videoPlayer, 76, 20)}, tea.WithAltScreen())
+	if _, err := program.Run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
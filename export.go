@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"cli-video-player/media"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Size of a character in the embedded bitmap font
+const FONT_WIDTH int = 7
+const FONT_HEIGHT int = 13
+
+type ExportOptions struct {
+	cols       int
+	rows       int
+	scale      int
+	width      int
+	height     int
+	background color.RGBA
+	foreground color.RGBA
+	audio      bool
+}
+
+// Exports a video as rendered ASCII to an animated GIF, or to any format ffmpeg can encode
+func runExport(args []string) {
+	flags := newFlagSet("export")
+	output := flags.String("o", "", "output file, the format is picked by extension: .gif, .apng, .mp4, .webm, .mkv (default '<video name>.gif')")
+	cols := flags.Int("cols", 80, "width of the rendered video in characters")
+	rows := flags.Int("rows", 24, "height of the rendered video in characters")
+	scale := flags.Int("scale", 1, "size of a character as a multiple of the 7x13 pixel font")
+	width := flags.Int("width", 0, "width of the output in pixels, overrides --cols")
+	height := flags.Int("height", 0, "height of the output in pixels, overrides --rows")
+	background := flags.String("background", "#000000", "background color")
+	foreground := flags.String("foreground", "#ffffff", "character color")
+	noAudio := flags.Bool("no-audio", !EXPORT_AUDIO, "don't copy the audio of the source video")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return
+	}
+	if len(args) != 1 {
+		printUsageError(flags.Name(), "Expected one video to export, got", len(args), "arguments.")
+		return
+	}
+	path := args[0]
+
+	if *scale < 1 {
+		printError("--scale has to be at least 1.")
+		return
+	}
+
+	options := ExportOptions{cols: *cols, rows: *rows, scale: *scale, width: *width, height: *height, audio: !*noAudio}
+	var err error
+	if options.background, err = parseHexColor(*background); err != nil {
+		printError("Invalid --background:", err)
+		return
+	}
+	if options.foreground, err = parseHexColor(*foreground); err != nil {
+		printError("Invalid --foreground:", err)
+		return
+	}
+	// the character grid is derived from the output dimensions when they are given
+	if options.width > 0 {
+		options.cols = options.width / (FONT_WIDTH * options.scale)
+	}
+	if options.height > 0 {
+		options.rows = options.height / (FONT_HEIGHT * options.scale)
+	}
+	if options.cols < 1 || options.rows < 1 {
+		printError("The output has to fit at least one character.")
+		return
+	}
+	if options.width == 0 {
+		options.width = options.cols * FONT_WIDTH * options.scale
+	}
+	if options.height == 0 {
+		options.height = options.rows * FONT_HEIGHT * options.scale
+	}
+
+	if _, err := os.Stat(path); err != nil && !media.IsLavfi(path) {
+		printError("File '" + path + "' could not be found.")
+		return
+	}
+	video := loadVideo(path)
+	if video.fps == 0 {
+		printError("'" + path + "' is not a valid video.")
+		return
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".gif"
+	}
+
+	startTime := time.Now()
+	var frames int
+	if strings.ToLower(filepath.Ext(*output)) == ".gif" {
+		frames, err = exportGif(&video, *output, options)
+	} else {
+		frames, err = exportFfmpeg(&video, *output, options)
+	}
+	if err != nil {
+		printError("Could not export '"+path+"':", err)
+		return
+	}
+	fmt.Printf("%s Exported %d frames to '%s' in %s.\n", PREFIX, frames, *output, time.Since(startTime).Round(time.Millisecond))
+}
+
+// Encodes the frames with the background and foreground as the only colors, one frame at a time
+func exportGif(video *Video, output string, options ExportOptions) (int, error) {
+	file, err := os.Create(output)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	writer := newGifWriter(file)
+	img := image.NewPaletted(image.Rect(0, 0, options.width, options.height), color.Palette{options.background, options.foreground})
+
+	var frames int
+	var writeErr error
+	decodeErr := decodeVideo(video, 0, video.totalFrames, func(frame Frame) bool {
+		ascii := frameToAscii(&frame, video.width, video.height, CHANNELS, DEFAULT_ASCII, options.cols, options.rows)
+		rasterizeAscii(img, ascii, options)
+		// gif delays are in 100ths of a second, spread the rounding over the frames
+		delay := int(float64(frames+1)*100/video.fps) - int(float64(frames)*100/video.fps)
+		if writeErr = writer.WriteFrame(img, delay); writeErr != nil {
+			return false
+		}
+		frames++
+		return true
+	})
+	if decodeErr != nil {
+		return frames, decodeErr
+	}
+	if writeErr != nil {
+		return frames, writeErr
+	}
+	if frames == 0 {
+		return 0, errors.New("no frames could be decoded")
+	}
+	if err := writer.Close(); err != nil {
+		return frames, err
+	}
+	return frames, file.Close()
+}
+
+// Writes an animated GIF that loops forever a frame at a time. image/gif only encodes whole
+// animations, so every frame is encoded as a GIF of its own and its image block is copied over.
+// All frames have to use the palette of the first one.
+type GifWriter struct {
+	writer  *bufio.Writer
+	started bool
+}
+
+func newGifWriter(writer io.Writer) *GifWriter {
+	return &GifWriter{writer: bufio.NewWriter(writer)}
+}
+
+// Adds a frame shown for delay 100ths of a second
+func (gifWriter *GifWriter) WriteFrame(img *image.Paletted, delay int) error {
+	var buffer bytes.Buffer
+	if err := gif.Encode(&buffer, img, nil); err != nil {
+		return err
+	}
+	data := buffer.Bytes()
+	// the header and logical screen descriptor, followed by the global color table
+	blockStart := 13
+	if data[10]&0x80 != 0 {
+		blockStart += 3 << (data[10]&0x07 + 1)
+	}
+	if !gifWriter.started {
+		gifWriter.writer.Write(data[:blockStart])
+		gifWriter.writer.Write([]byte{0x21, 0xFF, 0x0B})
+		gifWriter.writer.WriteString("NETSCAPE2.0")
+		gifWriter.writer.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+		gifWriter.started = true
+	}
+	// replaced by the graphic control extension with the delay
+	if data[blockStart] == 0x21 && data[blockStart+1] == 0xF9 {
+		blockStart += 8
+	}
+	gifWriter.writer.Write([]byte{0x21, 0xF9, 0x04, 0x00, byte(delay), byte(delay >> 8), 0x00, 0x00})
+	// everything up to the trailer
+	_, err := gifWriter.writer.Write(data[blockStart : len(data)-1])
+	return err
+}
+
+// Ends the animation, the underlying writer stays open
+func (gifWriter *GifWriter) Close() error {
+	gifWriter.writer.WriteByte(0x3B)
+	return gifWriter.writer.Flush()
+}
+
+// Pipes raw RGB frames into ffmpeg, which encodes them and copies the audio of the source.
+// Frames are written as they are rendered, so memory use doesn't grow with the length of the video.
+func exportFfmpeg(video *Video, output string, options ExportOptions) (int, error) {
+	extension := strings.ToLower(filepath.Ext(output))
+	isAnimation := extension == ".apng"
+	// most video encoders need even dimensions
+	if !isAnimation {
+		options.width -= options.width % 2
+		options.height -= options.height % 2
+	}
+
+	args := []string{
+		"-y",
+		"-loglevel", "error",
+		"-f", "rawvideo",
+		"-pix_fmt", "rgba",
+		"-s", fmt.Sprintf("%dx%d", options.width, options.height),
+		"-r", strconv.FormatFloat(video.fps, 'f', -1, 64),
+		"-i", "-",
+	}
+	// generated sources have no audio
+	if options.audio && !isAnimation && !media.IsLavfi(video.filepath) {
+		args = append(args, media.InputArgs(video.filepath)...)
+		args = append(args, "-map", "0:v", "-map", "1:a?", "-shortest")
+	}
+	switch extension {
+	case ".apng":
+		args = append(args, "-f", "apng", "-plays", "0")
+	case ".mp4", ".m4v", ".mov":
+		args = append(args, "-pix_fmt", "yuv420p", "-movflags", "+faststart")
+	default:
+		args = append(args, "-pix_fmt", "yuv420p")
+	}
+	args = append(args, output)
+
+	cmd := exec.Command("ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	var frames int
+	var writeErr error
+	img := image.NewRGBA(image.Rect(0, 0, options.width, options.height))
+	decodeErr := decodeVideo(video, 0, video.totalFrames, func(frame Frame) bool {
+		ascii := frameToAscii(&frame, video.width, video.height, CHANNELS, DEFAULT_ASCII, options.cols, options.rows)
+		rasterizeAscii(img, ascii, options)
+		// ffmpeg exited, its error is reported below
+		if _, err := stdin.Write(img.Pix); err != nil {
+			writeErr = err
+			return false
+		}
+		frames++
+		return true
+	})
+	stdin.Close()
+
+	if err := cmd.Wait(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return frames, fmt.Errorf("ffmpeg failed: %v\n%s", err, message)
+		}
+		return frames, fmt.Errorf("ffmpeg failed: %v", err)
+	}
+	if decodeErr != nil {
+		return frames, decodeErr
+	}
+	if writeErr == nil && frames == 0 {
+		return 0, errors.New("no frames could be decoded")
+	}
+	return frames, writeErr
+}
+
+// Draws the characters of an ASCII frame onto the image with the embedded bitmap font
+func rasterizeAscii(img draw.Image, ascii *string, options ExportOptions) {
+	draw.Draw(img, img.Bounds(), image.NewUniform(options.background), image.Point{}, draw.Src)
+
+	// draw unscaled, then scale up with nearest neighbour so the font stays sharp
+	glyphs := image.NewAlpha(image.Rect(0, 0, options.cols*FONT_WIDTH, options.rows*FONT_HEIGHT))
+	drawer := font.Drawer{Dst: glyphs, Src: image.Opaque, Face: basicfont.Face7x13}
+	for row := 0; row < options.rows; row++ {
+		drawer.Dot = fixed.P(0, row*FONT_HEIGHT+basicfont.Face7x13.Ascent)
+		drawer.DrawString((*ascii)[row*options.cols : (row+1)*options.cols])
+	}
+
+	foreground := image.NewUniform(options.foreground)
+	bounds := img.Bounds()
+	for y := 0; y < min(bounds.Dy(), glyphs.Rect.Dy()*options.scale); y++ {
+		for x := 0; x < min(bounds.Dx(), glyphs.Rect.Dx()*options.scale); x++ {
+			if glyphs.AlphaAt(x/options.scale, y/options.scale).A > 127 {
+				img.Set(x, y, foreground.C)
+			}
+		}
+	}
+}
+
+func parseHexColor(value string) (color.RGBA, error) {
+	value = strings.TrimPrefix(value, "#")
+	rgb, err := strconv.ParseUint(value, 16, 32)
+	if err != nil || len(value) != 6 {
+		return color.RGBA{}, fmt.Errorf("'%s' is not a color like #rrggbb", value)
+	}
+	return color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255}, nil
+}
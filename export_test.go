@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"cli-video-player/media"
+)
+
+func TestGifWriter(t *testing.T) {
+	palette := color.Palette{color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}}
+	var frames []*image.Paletted
+	for i := 0; i < 3; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 14, 13), palette)
+		for pixel := range frame.Pix {
+			frame.Pix[pixel] = uint8((pixel / (i + 1)) % 2)
+		}
+		frames = append(frames, frame)
+	}
+	delays := []int{4, 3, 300}
+
+	var buffer bytes.Buffer
+	writer := newGifWriter(&buffer)
+	for i, frame := range frames {
+		if err := writer.WriteFrame(frame, delays[i]); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	animation, err := gif.DecodeAll(&buffer)
+	if err != nil {
+		t.Fatalf("decoding the written gif: %v", err)
+	}
+	if animation.Config.Width != 14 || animation.Config.Height != 13 {
+		t.Errorf("size is %dx%d, want 14x13", animation.Config.Width, animation.Config.Height)
+	}
+	if animation.LoopCount != 0 {
+		t.Errorf("LoopCount = %d, want 0 to loop forever", animation.LoopCount)
+	}
+	if !slices.Equal(animation.Delay, delays) {
+		t.Errorf("delays are %v, want %v", animation.Delay, delays)
+	}
+	if len(animation.Image) != len(frames) {
+		t.Fatalf("decoded %d frames, want %d", len(animation.Image), len(frames))
+	}
+	for i, frame := range animation.Image {
+		if !slices.Equal(frame.Pix, frames[i].Pix) {
+			t.Errorf("pixels of frame %d changed", i)
+		}
+		if len(frame.Palette) != 2 || frame.Palette[0] != palette[0] || frame.Palette[1] != palette[1] {
+			t.Errorf("palette of frame %d is %v, want %v", i, frame.Palette, palette)
+		}
+	}
+}
+
+func TestExportGif(t *testing.T) {
+	decoder := media.NewMemoryDecoder("memory", 8, 4, 30, media.PatternFrames(8, 4, 10))
+	info, _ := decoder.Probe()
+	video := videoFromMedia(&info, decoder)
+	defer decoder.Close()
+	options := ExportOptions{cols: 4, rows: 2, scale: 2, width: 56, height: 52, background: color.RGBA{0, 0, 0, 255}, foreground: color.RGBA{255, 255, 255, 255}}
+	output := filepath.Join(t.TempDir(), "export.gif")
+
+	frames, err := exportGif(&video, output, options)
+	if err != nil {
+		t.Fatalf("exportGif: %v", err)
+	}
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	animation, err := gif.DecodeAll(file)
+	if err != nil {
+		t.Fatalf("decoding the export: %v", err)
+	}
+	if frames != 10 || len(animation.Image) != 10 {
+		t.Fatalf("exported %d frames and decoded %d, want 10", frames, len(animation.Image))
+	}
+	// a third of a second at 30 fps
+	total := 0
+	for _, delay := range animation.Delay {
+		total += delay
+	}
+	if total != 33 {
+		t.Errorf("the delays add up to %d 100ths of a second, want 33", total)
+	}
+	if animation.Config.Width != 56 || animation.Config.Height != 52 {
+		t.Errorf("size is %dx%d, want 56x52", animation.Config.Width, animation.Config.Height)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cli-video-player/media"
+)
+
+const HISTORY_FILE = "history.json"
+
+// Can be turned off in the config file or with --no-history
+var HISTORY_ENABLED bool = true
+var HISTORY_MAX_ENTRIES int = 1000
+
+// 0 keeps entries forever
+var HISTORY_MAX_AGE time.Duration = 0
+
+// A played file, most recently played first. Watched is the time spent playing in seconds,
+// over all plays. Completed is set when the file was played to the end the last time.
+type HistoryEntry struct {
+	Path        string    `json:"path"`
+	FirstPlayed time.Time `json:"first_played"`
+	LastPlayed  time.Time `json:"last_played"`
+	Plays       int       `json:"plays"`
+	Watched     float64   `json:"watched"`
+	Position    float64   `json:"position"`
+	Duration    float64   `json:"duration"`
+	Completed   bool      `json:"completed"`
+}
+
+type History struct {
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// The file that is playing right now
+type WatchSession struct {
+	path     string
+	started  time.Time
+	watched  time.Duration
+	lastTick time.Time
+}
+
+var WATCHING *WatchSession
+
+// Paths are stored absolute so they can be reopened from anywhere, pipes can't be reopened at all
+func historyPath(path string) (string, bool) {
+	if path == "-" || isStream(path) {
+		return "", false
+	}
+	if media.IsUrl(path) || media.IsLavfi(path) {
+		return path, true
+	}
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return path, true
+	}
+	return absolutePath, true
+}
+
+func startWatching(path string) {
+	key, ok := historyPath(path)
+	if !HISTORY_ENABLED || !ok {
+		WATCHING = nil
+		return
+	}
+	WATCHING = &WatchSession{path: key, started: time.Now()}
+}
+
+// Adds up the time spent playing. Runs every frame.
+func handleHistory() {
+	session := WATCHING
+	if session == nil {
+		return
+	}
+	now := time.Now()
+	if !paused() && !session.lastTick.IsZero() {
+		session.watched += now.Sub(session.lastTick)
+	}
+	session.lastTick = now
+}
+
+// Records the file that stopped playing. It is complete when playback ended on its own,
+// or when it stopped within RESUME_END_SECONDS of the end.
+func recordHistory(video *Video) {
+	session := WATCHING
+	WATCHING = nil
+	if session == nil {
+		return
+	}
+	position := 0.0
+	if video.fps > 0 {
+		position = float64(currentFrame()) / video.fps
+	}
+	completed := !PLAYING || watchedToEnd(video)
+
+	// read again right before writing, other players could have saved in the meantime
+	history := readHistory()
+	entry := HistoryEntry{Path: session.path, FirstPlayed: session.started}
+	for i, existing := range history.Entries {
+		if existing.Path == session.path {
+			entry = existing
+			history.Entries = append(history.Entries[:i], history.Entries[i+1:]...)
+			break
+		}
+	}
+	entry.LastPlayed = time.Now()
+	entry.Plays++
+	entry.Watched += session.watched.Seconds()
+	entry.Position = position
+	entry.Duration = video.duration.Seconds()
+	entry.Completed = completed
+	history.Entries = append([]HistoryEntry{entry}, history.Entries...)
+	pruneHistory(&history, time.Now())
+	if err := writeStateFile(HISTORY_FILE, history); err != nil {
+		fmt.Println(PREFIX, "Could not save the history:", err)
+	}
+}
+
+func readHistory() History {
+	history := History{}
+	readStateFile(HISTORY_FILE, &history)
+	return history
+}
+
+// Drops entries beyond HISTORY_MAX_ENTRIES and entries older than HISTORY_MAX_AGE.
+// Returns the amount of dropped entries.
+func pruneHistory(history *History, now time.Time) int {
+	kept := history.Entries[:0]
+	for i, entry := range history.Entries {
+		if i >= HISTORY_MAX_ENTRIES || (HISTORY_MAX_AGE > 0 && now.Sub(entry.LastPlayed) > HISTORY_MAX_AGE) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	dropped := len(history.Entries) - len(kept)
+	history.Entries = kept
+	return dropped
+}
+
+// Lists recently played files
+func runHistory(args []string) {
+	flags := newFlagSet("history")
+	count := flags.Int("n", 20, "amount of entries to show, 0 shows all")
+	asJson := flags.Bool("json", false, "print the entries as JSON")
+	clearHistory := flags.Bool("clear", false, "forget every played file")
+	prune := flags.Bool("prune", false, "drop entries beyond history.max_entries or older than history.max_age_days")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return
+	}
+	if len(args) > 0 {
+		printUsageError(flags.Name(), "Unknown arguments:", args)
+		return
+	}
+	if *count < 0 {
+		printUsageError(flags.Name(), "-n can't be negative.")
+		return
+	}
+
+	history := readHistory()
+	if *clearHistory {
+		if err := writeStateFile(HISTORY_FILE, History{}); err != nil {
+			printError("Could not clear the history:", err)
+			return
+		}
+		fmt.Println(PREFIX, "Cleared the history of", len(history.Entries), "files.")
+		return
+	}
+	if *prune {
+		dropped := pruneHistory(&history, time.Now())
+		if err := writeStateFile(HISTORY_FILE, history); err != nil {
+			printError("Could not prune the history:", err)
+			return
+		}
+		fmt.Println(PREFIX, "Dropped", dropped, "entries from the history.")
+		return
+	}
+
+	entries := history.Entries
+	if *count > 0 && len(entries) > *count {
+		entries = entries[:*count]
+	}
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(entries)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println(PREFIX, "Nothing has been played yet.")
+		if !HISTORY_ENABLED {
+			fmt.Println(strings.Repeat(" ", len(PREFIX_TEXT)), "The history is turned off in the config.")
+		}
+		return
+	}
+	fmt.Printf("%-16s  %-17s  %-8s  %5s  %s\n", "Played", "Progress", "Watched", "Plays", "File")
+	for _, entry := range entries {
+		progress := formatClock(entry.Position)
+		if entry.Completed {
+			progress = "finished"
+		} else if entry.Duration > 0 {
+			progress += " / " + formatClock(entry.Duration)
+		}
+		fmt.Printf("%-16s  %-17s  %-8s  %5d  %s\n", entry.LastPlayed.Local().Format("2006-01-02 15:04"),
+			progress, formatClock(entry.Watched), entry.Plays, entry.Path)
+	}
+}
+
+// Plays the most recently played file that still exists, flags are passed on
+func runLast(args []string) {
+	for _, entry := range readHistory().Entries {
+		if _, err := os.Stat(entry.Path); err != nil && !media.IsUrl(entry.Path) && !media.IsLavfi(entry.Path) {
+			continue
+		}
+		runPlay(append(append([]string{}, args...), "--", entry.Path))
+		return
+	}
+	printError("There is nothing in the history to play.")
+}
+
+// Formats seconds as [H:]MM:SS
+func formatClock(seconds float64) string {
+	total := int(seconds)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
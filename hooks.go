@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const HOOKS_LOG_FILE = "hooks.log"
+
+// Hook output kept in the log when a hook fails
+const HOOK_OUTPUT_LIMIT int = 500
+
+var HOOK_EVENTS = []string{"start", "pause", "resume", "seek", "end", "quit"}
+
+// Commands run for events, from the hooks section of the config
+var HOOKS = map[string]string{}
+var HOOK_TIMEOUT time.Duration = 10 * time.Second
+
+// Hooks still running, waited for before exiting
+var HOOKS_RUNNING sync.WaitGroup
+
+// Set once playback started, there is nothing to end or quit before
+var HOOK_STARTED bool = false
+
+var HOOK_LOG *log.Logger
+var hookLogOnce sync.Once
+
+// Runs the command for the event in the background. The environment describes the
+// player at the moment of the event, since the command may start later.
+func runHook(event string) {
+	if event == "start" {
+		HOOK_STARTED = true
+	}
+	command := HOOKS[event]
+	if command == "" {
+		return
+	}
+	env := append(os.Environ(), hookEnvironment(event, &CURRENT_VIDEO)...)
+	HOOKS_RUNNING.Add(1)
+	go func() {
+		defer HOOKS_RUNNING.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), HOOK_TIMEOUT)
+		defer cancel()
+		cmd := shellCommand(ctx, command)
+		cmd.Env = env
+		// children of the shell can keep the output open after it was killed
+		cmd.WaitDelay = time.Second
+		output, err := cmd.CombinedOutput()
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", HOOK_TIMEOUT)
+		}
+		if err != nil {
+			logHookFailure(event, command, err, output)
+		}
+	}()
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+func hookEnvironment(event string, video *Video) []string {
+	state := "playing"
+	if paused() {
+		state = "paused"
+	}
+	frame := currentFrame()
+	position := 0.0
+	if video.fps > 0 {
+		position = float64(frame) / video.fps
+	}
+	return []string{
+		CONFIG_ENV_PREFIX + "EVENT=" + event,
+		CONFIG_ENV_PREFIX + "FILE=" + video.filepath,
+		CONFIG_ENV_PREFIX + "POSITION=" + strconv.FormatFloat(position, 'f', 3, 64),
+		CONFIG_ENV_PREFIX + "FRAME=" + strconv.Itoa(frame),
+		CONFIG_ENV_PREFIX + "DURATION=" + strconv.FormatFloat(video.duration.Seconds(), 'f', 3, 64),
+		CONFIG_ENV_PREFIX + "STATE=" + state,
+		CONFIG_ENV_PREFIX + "PID=" + strconv.Itoa(os.Getpid()),
+	}
+}
+
+// Failures end up in the log in the state directory, the player keeps going
+func logHookFailure(event string, command string, err error, output []byte) {
+	hookLogOnce.Do(func() {
+		os.MkdirAll(stateDir(), 0o755)
+		file, openErr := os.OpenFile(filepath.Join(stateDir(), HOOKS_LOG_FILE), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if openErr != nil {
+			return
+		}
+		HOOK_LOG = log.New(file, "", log.LstdFlags)
+	})
+	text := strings.TrimSpace(string(output))
+	if len(text) > HOOK_OUTPUT_LIMIT {
+		text = text[:HOOK_OUTPUT_LIMIT] + "..."
+	}
+	if HOOK_LOG != nil {
+		HOOK_LOG.Printf("on_%s '%s' failed: %v %s", event, command, err, text)
+	}
+	postStatusMessage(fmt.Sprintf("on_%s hook failed: %v", event, err))
+}
+
+// Gives the running hooks until their timeout to finish, so quitting doesn't cut them off
+func waitForHooks() {
+	HOOKS_RUNNING.Wait()
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/webp"
+)
+
+// Delays shorter than the minimum are played at the default delay instead,
+// the convention browsers follow. It applies to every animated format.
+const MIN_FRAME_DELAY = 20 * time.Millisecond
+const DEFAULT_FRAME_DELAY = 100 * time.Millisecond
+
+var PNG_SIGNATURE = []byte("\x89PNG\r\n\x1a\n")
+
+// Decoded frames of an image file, composited to the full canvas.
+// loops is how often the frames are played, 0 is forever.
+type DecodedImage struct {
+	frames []*image.RGBA
+	delays []time.Duration
+	loops  int
+}
+
+func decodeImageFile(path string) (*DecodedImage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gif":
+		return decodeGif(data)
+	case ".png", ".apng":
+		if isApng(data) {
+			return decodeApng(data)
+		}
+	case ".webp":
+		if isAnimatedWebp(data) {
+			return decodeAnimatedWebp(data)
+		}
+		img, err := webp.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return stillImage(img), nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return stillImage(img), nil
+}
+
+func stillImage(img image.Image) *DecodedImage {
+	canvas := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(canvas, canvas.Bounds(), img, img.Bounds().Min, draw.Src)
+	return &DecodedImage{frames: []*image.RGBA{canvas}, delays: []time.Duration{0}, loops: 1}
+}
+
+func frameDelay(delay time.Duration) time.Duration {
+	if delay < MIN_FRAME_DELAY {
+		return DEFAULT_FRAME_DELAY
+	}
+	return delay
+}
+
+func decodeGif(data []byte) (*DecodedImage, error) {
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	decoded := &DecodedImage{}
+	// the netscape extension counts repetitions after the first play, -1 when it's missing
+	switch {
+	case animation.LoopCount == 0:
+		decoded.loops = 0
+	case animation.LoopCount < 0:
+		decoded.loops = 1
+	default:
+		decoded.loops = animation.LoopCount + 1
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, animation.Config.Width, animation.Config.Height))
+	for i, frame := range animation.Image {
+		bounds := frame.Bounds()
+		var disposal byte
+		if i < len(animation.Disposal) {
+			disposal = animation.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = copyCanvas(canvas)
+		}
+		draw.Draw(canvas, bounds, frame, bounds.Min, draw.Over)
+		decoded.frames = append(decoded.frames, copyCanvas(canvas))
+		decoded.delays = append(decoded.delays, frameDelay(time.Duration(animation.Delay[i])*10*time.Millisecond))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, bounds, image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	if len(decoded.frames) == 0 {
+		return nil, errors.New("gif has no frames")
+	}
+	return decoded, nil
+}
+
+func copyCanvas(canvas *image.RGBA) *image.RGBA {
+	copied := image.NewRGBA(canvas.Bounds())
+	copy(copied.Pix, canvas.Pix)
+	return copied
+}
+
+type PngChunk struct {
+	name string
+	data []byte
+}
+
+func readPngChunks(data []byte) ([]PngChunk, error) {
+	if !bytes.HasPrefix(data, PNG_SIGNATURE) {
+		return nil, errors.New("not a png file")
+	}
+	var chunks []PngChunk
+	for offset := len(PNG_SIGNATURE); offset+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		end := offset + 8 + length + 4
+		if length < 0 || end > len(data) {
+			return nil, errors.New("truncated png chunk")
+		}
+		chunks = append(chunks, PngChunk{string(data[offset+4 : offset+8]), data[offset+8 : offset+8+length]})
+		offset = end
+	}
+	return chunks, nil
+}
+
+func writePngChunk(buffer *bytes.Buffer, name string, data []byte) {
+	binary.Write(buffer, binary.BigEndian, uint32(len(data)))
+	buffer.WriteString(name)
+	buffer.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(name))
+	crc.Write(data)
+	binary.Write(buffer, binary.BigEndian, crc.Sum32())
+}
+
+// Animated PNGs have an acTL chunk before the image data
+func isApng(data []byte) bool {
+	chunks, err := readPngChunks(data)
+	if err != nil {
+		return false
+	}
+	for _, chunk := range chunks {
+		if chunk.name == "acTL" {
+			return true
+		}
+		if chunk.name == "IDAT" {
+			return false
+		}
+	}
+	return false
+}
+
+type ApngFrame struct {
+	width     int
+	height    int
+	x         int
+	y         int
+	delay     time.Duration
+	dispose   byte
+	blend     byte
+	imageData [][]byte
+}
+
+// Every APNG frame is decoded as a separate PNG, built from the shared header chunks and its own data
+func decodeApng(data []byte) (*DecodedImage, error) {
+	chunks, err := readPngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	var header []byte
+	var shared []PngChunk
+	var frames []*ApngFrame
+	decoded := &DecodedImage{}
+
+	for _, chunk := range chunks {
+		switch chunk.name {
+		case "IHDR":
+			header = chunk.data
+		case "PLTE", "tRNS", "gAMA", "cHRM", "sRGB", "iCCP":
+			shared = append(shared, chunk)
+		case "acTL":
+			if len(chunk.data) < 8 {
+				return nil, errors.New("invalid acTL chunk")
+			}
+			decoded.loops = int(binary.BigEndian.Uint32(chunk.data[4:]))
+		case "fcTL":
+			if len(chunk.data) < 26 {
+				return nil, errors.New("invalid fcTL chunk")
+			}
+			numerator := binary.BigEndian.Uint16(chunk.data[20:])
+			denominator := binary.BigEndian.Uint16(chunk.data[22:])
+			if denominator == 0 {
+				denominator = 100
+			}
+			frames = append(frames, &ApngFrame{
+				width:   int(binary.BigEndian.Uint32(chunk.data[4:])),
+				height:  int(binary.BigEndian.Uint32(chunk.data[8:])),
+				x:       int(binary.BigEndian.Uint32(chunk.data[12:])),
+				y:       int(binary.BigEndian.Uint32(chunk.data[16:])),
+				delay:   time.Duration(numerator) * time.Second / time.Duration(denominator),
+				dispose: chunk.data[24],
+				blend:   chunk.data[25],
+			})
+		case "IDAT":
+			// image data before the first fcTL is a fallback that isn't part of the animation
+			if len(frames) > 0 {
+				frames[len(frames)-1].imageData = append(frames[len(frames)-1].imageData, chunk.data)
+			}
+		case "fdAT":
+			if len(frames) > 0 && len(chunk.data) > 4 {
+				frames[len(frames)-1].imageData = append(frames[len(frames)-1].imageData, chunk.data[4:])
+			}
+		}
+	}
+	if len(header) < 13 || len(frames) == 0 {
+		return nil, errors.New("invalid animated png")
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, int(binary.BigEndian.Uint32(header[0:])), int(binary.BigEndian.Uint32(header[4:]))))
+	for i, frame := range frames {
+		var buffer bytes.Buffer
+		buffer.Write(PNG_SIGNATURE)
+		frameHeader := append([]byte{}, header...)
+		binary.BigEndian.PutUint32(frameHeader[0:], uint32(frame.width))
+		binary.BigEndian.PutUint32(frameHeader[4:], uint32(frame.height))
+		writePngChunk(&buffer, "IHDR", frameHeader)
+		for _, chunk := range shared {
+			writePngChunk(&buffer, chunk.name, chunk.data)
+		}
+		for _, imageData := range frame.imageData {
+			writePngChunk(&buffer, "IDAT", imageData)
+		}
+		writePngChunk(&buffer, "IEND", nil)
+
+		img, err := png.Decode(&buffer)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %v", i, err)
+		}
+
+		bounds := image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height)
+		var previous *image.RGBA
+		if frame.dispose == 2 {
+			previous = copyCanvas(canvas)
+		}
+		// blend operation 0 replaces the region, 1 draws over it
+		operation := draw.Src
+		if frame.blend == 1 {
+			operation = draw.Over
+		}
+		draw.Draw(canvas, bounds, img, image.Point{}, operation)
+		decoded.frames = append(decoded.frames, copyCanvas(canvas))
+		decoded.delays = append(decoded.delays, frameDelay(frame.delay))
+
+		switch frame.dispose {
+		case 1:
+			draw.Draw(canvas, bounds, image.Transparent, image.Point{}, draw.Src)
+		case 2:
+			canvas = previous
+		}
+	}
+	return decoded, nil
+}
+
+type RiffChunk struct {
+	name string
+	data []byte
+}
+
+func readRiffChunks(data []byte) []RiffChunk {
+	var chunks []RiffChunk
+	for offset := 0; offset+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		end := offset + 8 + length
+		if length < 0 || end > len(data) {
+			break
+		}
+		chunks = append(chunks, RiffChunk{string(data[offset : offset+4]), data[offset+8 : end]})
+		// chunks are padded to an even length
+		offset = end + length%2
+	}
+	return chunks
+}
+
+func writeRiffChunk(buffer *bytes.Buffer, name string, data []byte) {
+	buffer.WriteString(name)
+	binary.Write(buffer, binary.LittleEndian, uint32(len(data)))
+	buffer.Write(data)
+	if len(data)%2 == 1 {
+		buffer.WriteByte(0)
+	}
+}
+
+func uint24(data []byte) int {
+	return int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+}
+
+// Animated WebPs have a VP8X chunk with the animation flag set
+func isAnimatedWebp(data []byte) bool {
+	if len(data) < 21 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return false
+	}
+	return string(data[12:16]) == "VP8X" && data[20]&0x02 != 0
+}
+
+// Every ANMF frame is decoded as a separate WebP file, holding only that frame's bitstream
+func decodeAnimatedWebp(data []byte) (*DecodedImage, error) {
+	chunks := readRiffChunks(data[12:])
+	if len(chunks) == 0 || chunks[0].name != "VP8X" || len(chunks[0].data) < 10 {
+		return nil, errors.New("invalid animated webp")
+	}
+	canvasWidth := uint24(chunks[0].data[4:]) + 1
+	canvasHeight := uint24(chunks[0].data[7:]) + 1
+	canvas := image.NewRGBA(image.Rect(0, 0, canvasWidth, canvasHeight))
+	decoded := &DecodedImage{}
+
+	for _, chunk := range chunks[1:] {
+		switch chunk.name {
+		case "ANIM":
+			if len(chunk.data) >= 6 {
+				decoded.loops = int(binary.LittleEndian.Uint16(chunk.data[4:]))
+			}
+		case "ANMF":
+			if len(chunk.data) < 16 {
+				return nil, errors.New("invalid ANMF chunk")
+			}
+			x := uint24(chunk.data[0:]) * 2
+			y := uint24(chunk.data[3:]) * 2
+			width := uint24(chunk.data[6:]) + 1
+			height := uint24(chunk.data[9:]) + 1
+			delay := time.Duration(uint24(chunk.data[12:])) * time.Millisecond
+			flags := chunk.data[15]
+
+			var frameData bytes.Buffer
+			var alpha []byte
+			for _, frameChunk := range readRiffChunks(chunk.data[16:]) {
+				switch frameChunk.name {
+				case "ALPH":
+					alpha = frameChunk.data
+				case "VP8 ", "VP8L":
+					// lossy frames with transparency need an extended header for the alpha chunk
+					if alpha != nil && frameChunk.name == "VP8 " {
+						extended := make([]byte, 10)
+						extended[0] = 0x10
+						extended[4], extended[5], extended[6] = byte(width-1), byte((width-1)>>8), byte((width-1)>>16)
+						extended[7], extended[8], extended[9] = byte(height-1), byte((height-1)>>8), byte((height-1)>>16)
+						writeRiffChunk(&frameData, "VP8X", extended)
+						writeRiffChunk(&frameData, "ALPH", alpha)
+					}
+					writeRiffChunk(&frameData, frameChunk.name, frameChunk.data)
+				}
+			}
+			var file bytes.Buffer
+			file.WriteString("RIFF")
+			binary.Write(&file, binary.LittleEndian, uint32(frameData.Len()+4))
+			file.WriteString("WEBP")
+			file.Write(frameData.Bytes())
+
+			img, err := webp.Decode(&file)
+			if err != nil {
+				return nil, fmt.Errorf("frame %d: %v", len(decoded.frames), err)
+			}
+			bounds := image.Rect(x, y, x+width, y+height)
+			// bit 1 disables blending, bit 0 clears the region after the frame
+			operation := draw.Over
+			if flags&0x02 != 0 {
+				operation = draw.Src
+			}
+			draw.Draw(canvas, bounds, img, img.Bounds().Min, operation)
+			decoded.frames = append(decoded.frames, copyCanvas(canvas))
+			decoded.delays = append(decoded.delays, frameDelay(delay))
+			if flags&0x01 != 0 {
+				draw.Draw(canvas, bounds, image.Transparent, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if len(decoded.frames) == 0 {
+		return nil, errors.New("webp has no frames")
+	}
+	return decoded, nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+var (
+	testRed         = color.RGBA{255, 0, 0, 255}
+	testBlue        = color.RGBA{0, 0, 255, 255}
+	testTransparent = color.RGBA{}
+)
+
+// Compares the frame with rows of 'r' for red, 'b' for blue and '.' for transparent pixels
+func expectCanvas(t *testing.T, frame *image.RGBA, rows ...string) {
+	t.Helper()
+	colors := map[byte]color.RGBA{'r': testRed, 'b': testBlue, '.': testTransparent}
+	if frame.Bounds().Dx() != len(rows[0]) || frame.Bounds().Dy() != len(rows) {
+		t.Fatalf("canvas is %v, want %dx%d", frame.Bounds().Size(), len(rows[0]), len(rows))
+	}
+	for y, row := range rows {
+		for x := range row {
+			if got := frame.RGBAAt(x, y); got != colors[row[x]] {
+				t.Errorf("pixel %d,%d is %v, want %v", x, y, got, colors[row[x]])
+			}
+		}
+	}
+}
+
+func expectAnimation(t *testing.T, decoded *DecodedImage, loops int, delays []time.Duration, canvases [][]string) {
+	t.Helper()
+	if len(decoded.frames) != len(canvases) || len(decoded.delays) != len(delays) {
+		t.Fatalf("decoded %d frames and %d delays, want %d", len(decoded.frames), len(decoded.delays), len(canvases))
+	}
+	if decoded.loops != loops {
+		t.Errorf("loops = %d, want %d", decoded.loops, loops)
+	}
+	for i := range canvases {
+		if decoded.delays[i] != delays[i] {
+			t.Errorf("delay of frame %d is %v, want %v", i, decoded.delays[i], delays[i])
+		}
+		expectCanvas(t, decoded.frames[i], canvases[i]...)
+	}
+}
+
+func filledImage(width int, height int, fill color.RGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = fill.R, fill.G, fill.B, fill.A
+	}
+	return img
+}
+
+func TestDecodeGif(t *testing.T) {
+	palette := color.Palette{testTransparent, testRed, testBlue}
+	paletted := func(bounds image.Rectangle, index uint8) *image.Paletted {
+		frame := image.NewPaletted(bounds, palette)
+		for i := range frame.Pix {
+			frame.Pix[i] = index
+		}
+		return frame
+	}
+	animation := &gif.GIF{
+		Image: []*image.Paletted{
+			paletted(image.Rect(0, 0, 4, 4), 1),
+			paletted(image.Rect(0, 0, 2, 2), 2),
+			paletted(image.Rect(2, 2, 4, 4), 2),
+			paletted(image.Rect(0, 0, 1, 1), 0),
+		},
+		// 1 is below the minimum and 0 means no delay, both play at the default
+		Delay:    []int{5, 1, 0, 2},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalBackground, gif.DisposalNone},
+		Config:   image.Config{ColorModel: palette, Width: 4, Height: 4},
+	}
+	delays := []time.Duration{50 * time.Millisecond, DEFAULT_FRAME_DELAY, DEFAULT_FRAME_DELAY, MIN_FRAME_DELAY}
+	canvases := [][]string{
+		{"rrrr", "rrrr", "rrrr", "rrrr"},
+		{"bbrr", "bbrr", "rrrr", "rrrr"},
+		// the blue corner was disposed back to red
+		{"rrrr", "rrrr", "rrbb", "rrbb"},
+		// a transparent frame doesn't cover the cleared background
+		{"rrrr", "rrrr", "rr..", "rr.."},
+	}
+
+	tests := []struct {
+		loopCount int
+		loops     int
+	}{
+		{0, 0},
+		{-1, 1},
+		{2, 3},
+	}
+	for _, test := range tests {
+		animation.LoopCount = test.loopCount
+		var buffer bytes.Buffer
+		if err := gif.EncodeAll(&buffer, animation); err != nil {
+			t.Fatalf("encoding the gif: %v", err)
+		}
+		decoded, err := decodeGif(buffer.Bytes())
+		if err != nil {
+			t.Fatalf("decodeGif: %v", err)
+		}
+		expectAnimation(t, decoded, test.loops, delays, canvases)
+	}
+}
+
+// The IHDR and concatenated image data of a png encoded with Go's encoder
+func encodePngChunks(t *testing.T, img image.Image) ([]byte, []byte) {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatalf("encoding the png: %v", err)
+	}
+	chunks, err := readPngChunks(buffer.Bytes())
+	if err != nil {
+		t.Fatalf("readPngChunks: %v", err)
+	}
+	var header, imageData []byte
+	for _, chunk := range chunks {
+		switch chunk.name {
+		case "IHDR":
+			header = chunk.data
+		case "IDAT":
+			imageData = append(imageData, chunk.data...)
+		}
+	}
+	return header, imageData
+}
+
+type testApngFrame struct {
+	img            image.Image
+	x, y           int
+	numerator      uint16
+	denominator    uint16
+	dispose, blend byte
+}
+
+func encodeApng(t *testing.T, width int, height int, plays int, fallback image.Image, frames []testApngFrame) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	buffer.Write(PNG_SIGNATURE)
+	header, _ := encodePngChunks(t, frames[0].img)
+	header = append([]byte{}, header...)
+	binary.BigEndian.PutUint32(header[0:], uint32(width))
+	binary.BigEndian.PutUint32(header[4:], uint32(height))
+	writePngChunk(&buffer, "IHDR", header)
+	actl := binary.BigEndian.AppendUint32(nil, uint32(len(frames)))
+	writePngChunk(&buffer, "acTL", binary.BigEndian.AppendUint32(actl, uint32(plays)))
+
+	sequence := uint32(0)
+	if fallback != nil {
+		_, imageData := encodePngChunks(t, fallback)
+		writePngChunk(&buffer, "IDAT", imageData)
+	}
+	for i, frame := range frames {
+		bounds := frame.img.Bounds()
+		fctl := binary.BigEndian.AppendUint32(nil, sequence)
+		for _, value := range []int{bounds.Dx(), bounds.Dy(), frame.x, frame.y} {
+			fctl = binary.BigEndian.AppendUint32(fctl, uint32(value))
+		}
+		fctl = binary.BigEndian.AppendUint16(fctl, frame.numerator)
+		fctl = binary.BigEndian.AppendUint16(fctl, frame.denominator)
+		writePngChunk(&buffer, "fcTL", append(fctl, frame.dispose, frame.blend))
+		sequence++
+
+		_, imageData := encodePngChunks(t, frame.img)
+		if i == 0 && fallback == nil {
+			// split in two to test that the data of a frame is joined again
+			writePngChunk(&buffer, "IDAT", imageData[:len(imageData)/2])
+			writePngChunk(&buffer, "IDAT", imageData[len(imageData)/2:])
+			continue
+		}
+		writePngChunk(&buffer, "fdAT", append(binary.BigEndian.AppendUint32(nil, sequence), imageData...))
+		sequence++
+	}
+	writePngChunk(&buffer, "IEND", nil)
+	return buffer.Bytes()
+}
+
+func TestDecodeApng(t *testing.T) {
+	frames := []testApngFrame{
+		{img: filledImage(4, 4, testRed), numerator: 1, denominator: 100},
+		// cleared to transparent afterwards
+		{img: filledImage(2, 2, testBlue), x: 2, y: 2, numerator: 3, denominator: 10, dispose: 1},
+		// restored to the previous canvas afterwards
+		{img: filledImage(1, 1, testBlue), numerator: 20, denominator: 1000, dispose: 2, blend: 1},
+		// a denominator of 0 means hundredths
+		{img: filledImage(1, 1, testBlue), x: 1, numerator: 5, denominator: 0},
+	}
+	delays := []time.Duration{DEFAULT_FRAME_DELAY, 300 * time.Millisecond, MIN_FRAME_DELAY, 50 * time.Millisecond}
+	canvases := [][]string{
+		{"rrrr", "rrrr", "rrrr", "rrrr"},
+		{"rrrr", "rrrr", "rrbb", "rrbb"},
+		{"brrr", "rrrr", "rr..", "rr.."},
+		{"rbrr", "rrrr", "rr..", "rr.."},
+	}
+
+	tests := []struct {
+		name     string
+		fallback image.Image
+	}{
+		{"first frame in IDAT", nil},
+		{"fallback image in IDAT", filledImage(4, 4, testBlue)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := encodeApng(t, 4, 4, 3, test.fallback, frames)
+			if !isApng(data) {
+				t.Fatal("isApng is false for an animated png")
+			}
+			decoded, err := decodeApng(data)
+			if err != nil {
+				t.Fatalf("decodeApng: %v", err)
+			}
+			expectAnimation(t, decoded, 3, delays, canvases)
+		})
+	}
+
+	still, _ := encodePngChunks(t, filledImage(4, 4, testRed))
+	var buffer bytes.Buffer
+	buffer.Write(PNG_SIGNATURE)
+	writePngChunk(&buffer, "IHDR", still)
+	if isApng(buffer.Bytes()) {
+		t.Error("isApng is true for a still png")
+	}
+}
+
+// Writes bits starting with the least significant one, like VP8L expects
+type testBitWriter struct {
+	data  []byte
+	count int
+}
+
+func (writer *testBitWriter) write(value int, bits int) {
+	for i := 0; i < bits; i++ {
+		if writer.count%8 == 0 {
+			writer.data = append(writer.data, 0)
+		}
+		writer.data[len(writer.data)-1] |= byte(value>>i&1) << (writer.count % 8)
+		writer.count++
+	}
+}
+
+// A lossless bitstream of a single colour. Every prefix code has a single symbol,
+// which takes no bits, so no pixel data follows the header.
+func encodeSolidVp8l(width int, height int, fill color.RGBA) []byte {
+	writer := &testBitWriter{}
+	writer.write(0x2f, 8)
+	writer.write(width-1, 14)
+	writer.write(height-1, 14)
+	writer.write(1, 1) // alpha is used
+	writer.write(0, 3) // version
+	writer.write(0, 1) // no transforms
+	writer.write(0, 1) // no color cache
+	writer.write(0, 1) // no meta prefix codes
+	// green, red, blue, alpha and distance
+	for _, symbol := range []uint8{fill.G, fill.R, fill.B, fill.A, 0} {
+		writer.write(1, 1) // simple code
+		writer.write(0, 1) // one symbol
+		writer.write(1, 1) // of 8 bits
+		writer.write(int(symbol), 8)
+	}
+	return writer.data
+}
+
+type testWebpFrame struct {
+	width, height int
+	fill          color.RGBA
+	x, y          int
+	duration      int
+	flags         byte
+}
+
+func encodeAnimatedWebp(width int, height int, loops int, frames []testWebpFrame) []byte {
+	uint24 := func(data []byte, value int) []byte {
+		return append(data, byte(value), byte(value>>8), byte(value>>16))
+	}
+	var chunks bytes.Buffer
+	writeRiffChunk(&chunks, "VP8X", uint24(uint24([]byte{0x02 | 0x10, 0, 0, 0}, width-1), height-1))
+	writeRiffChunk(&chunks, "ANIM", binary.LittleEndian.AppendUint16([]byte{0, 0, 0, 0}, uint16(loops)))
+	for _, frame := range frames {
+		var anmf []byte
+		anmf = uint24(anmf, frame.x/2)
+		anmf = uint24(anmf, frame.y/2)
+		anmf = uint24(anmf, frame.width-1)
+		anmf = uint24(anmf, frame.height-1)
+		anmf = uint24(anmf, frame.duration)
+		anmf = append(anmf, frame.flags)
+		var bitstream bytes.Buffer
+		writeRiffChunk(&bitstream, "VP8L", encodeSolidVp8l(frame.width, frame.height, frame.fill))
+		writeRiffChunk(&chunks, "ANMF", append(anmf, bitstream.Bytes()...))
+	}
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(chunks.Len()+4))
+	file.WriteString("WEBP")
+	file.Write(chunks.Bytes())
+	return file.Bytes()
+}
+
+func TestDecodeAnimatedWebp(t *testing.T) {
+	data := encodeAnimatedWebp(4, 4, 4, []testWebpFrame{
+		{width: 4, height: 4, fill: testRed, duration: 10, flags: 0x02},
+		// cleared to transparent afterwards
+		{width: 2, height: 2, fill: testBlue, x: 2, y: 2, duration: 250, flags: 0x01},
+		// drawn over the canvas, a transparent frame changes nothing
+		{width: 2, height: 2, fill: testTransparent, x: 2, y: 0, duration: 20},
+		// replaces the region, including with transparent pixels
+		{width: 2, height: 2, fill: testTransparent, duration: 19, flags: 0x02},
+	})
+	if !isAnimatedWebp(data) {
+		t.Fatal("isAnimatedWebp is false for an animated webp")
+	}
+	decoded, err := decodeAnimatedWebp(data)
+	if err != nil {
+		t.Fatalf("decodeAnimatedWebp: %v", err)
+	}
+	expectAnimation(t, decoded, 4,
+		[]time.Duration{DEFAULT_FRAME_DELAY, 250 * time.Millisecond, MIN_FRAME_DELAY, DEFAULT_FRAME_DELAY},
+		[][]string{
+			{"rrrr", "rrrr", "rrrr", "rrrr"},
+			{"rrrr", "rrrr", "rrbb", "rrbb"},
+			{"rrrr", "rrrr", "rr..", "rr.."},
+			{"..rr", "..rr", "rr..", "rr.."},
+		})
+}
+
+func TestFrameDelay(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  time.Duration
+	}{
+		{0, DEFAULT_FRAME_DELAY},
+		{MIN_FRAME_DELAY - time.Millisecond, DEFAULT_FRAME_DELAY},
+		{MIN_FRAME_DELAY, MIN_FRAME_DELAY},
+		{time.Second, time.Second},
+	}
+	for _, test := range tests {
+		if got := frameDelay(test.delay); got != test.want {
+			t.Errorf("frameDelay(%v) = %v, want %v", test.delay, got, test.want)
+		}
+	}
+}
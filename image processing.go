@@ -3,53 +3,25 @@ package main
 import (
 	"fmt"
 	"math"
+
+	"cli-video-player/render"
 )
 
 // Preprocesses a frame and converts to ASCII
 func processFrame(frameptr *Frame, width int, height int, channels int) *string {
-	asciiFrame := frameToAscii(frameptr, width, height, channels, DEFAULT_ASCII)
+	asciiFrame := frameToAscii(frameptr, width, height, channels, DEFAULT_ASCII, TERMINAL_WIDTH, TERMINAL_HEIGHT-3)
 	return asciiFrame
 }
 
-func frameToAscii(frameptr *Frame, width int, height int, channels int, characters string) *string {
-	frame := *frameptr
-
-	var frameWidth = TERMINAL_WIDTH
-	var frameHeight = TERMINAL_HEIGHT - 3
-	var gamma float64 = 0.8
-
-	var pixelWidth float32 = float32(width) / float32(frameWidth)
-	var pixelHeight float32 = float32(height) / float32(frameHeight)
-
-	var screen string = ""
-
-	for row := 0; row < frameHeight; row++ {
-		for col := 0; col < frameWidth; col++ {
-			var x int = int(pixelWidth * float32(col))
-			var y int = int(pixelHeight * float32(row))
-
-			var brightnessSum int
-			for pixelRow := 0; pixelRow < int(pixelHeight); pixelRow++ {
-				for pixelCol := 0; pixelCol < int(pixelWidth); pixelCol++ {
-					var localIndex int = (((y + pixelRow) * width) + x + pixelCol) * channels
-					brightnessSum += int(frame[localIndex])
-				}
-			}
-
-			var averageBrightness float64 = float64(brightnessSum / (int(pixelHeight) * int(pixelWidth)))
-			var normalizedBrightness float64 = averageBrightness / 255.0
-			var gammaCorrectedBrightness = math.Pow(normalizedBrightness, gamma)
-
-			var charIndex = int((1 - gammaCorrectedBrightness) * float64(len(characters)-1))
-			screen += string(characters[charIndex])
-		}
-	}
+// Converts a frame to ASCII with frameWidth x frameHeight characters (without line breaks)
+func frameToAscii(frameptr *Frame, width int, height int, channels int, characters string, frameWidth int, frameHeight int) *string {
+	screen := render.FrameToAscii(*frameptr, width, height, channels, characters, GAMMA, frameWidth, frameHeight)
 	return &screen
 }
 
 func subtractFrame(firstFrame *Frame, secondFrame *Frame) *Frame {
 	if len(*firstFrame) != len(*secondFrame) {
-		fmt.Errorf("subractFrame(): Frames are not of the same size")
+		fmt.Println(PREFIX, "subtractFrame(): Frames are not of the same size")
 	}
 
 	var frameDiff Frame
@@ -69,7 +41,7 @@ func subtractFrame(firstFrame *Frame, secondFrame *Frame) *Frame {
 // overlays the second string on top of the first (space characters are ignored)
 func addString(firstFrame *string, secondFrame *string) *string {
 	if len(*firstFrame) != len(*secondFrame) {
-		fmt.Errorf("addString(): Strings are not of the same size")
+		fmt.Println(PREFIX, "addString(): Strings are not of the same size")
 	}
 
 	var frameSum string
@@ -86,7 +58,11 @@ func addString(firstFrame *string, secondFrame *string) *string {
 }
 
 func printFrame(frame *string) {
-	fmt.Print("\033[K\033[1G" + gotoCharacter(0, 0) + HELP_MENU + gotoCharacter(0, 1) + *frame)
+	fmt.Print(formatFrame(frame))
+}
+
+func formatFrame(frame *string) string {
+	return "\033[K\033[1G" + gotoCharacter(0, 0) + HELP_MENU + gotoCharacter(0, 1) + *frame
 }
 
 func generateGaussianKernel(radius int, sigma float64) [][]float64 {
@@ -152,29 +128,15 @@ func gaussianBlur(width int, height int, frameptr *Frame, sigma float64, radius
 // Result also contains escape characters to move cursor to right locations.
 // This results in having to print less characters to the screen.
 func getFrameDiff(oldFramePtr *string, newFramePtr *string) string {
-	oldFrame := *oldFramePtr
-	newFrame := *newFramePtr
-
-	var diff string = ""
-	var prevCharEqual bool = true
-
-	for char := 0; char < len(oldFrame); char++ {
-		if oldFrame[char] != newFrame[char] {
-			if prevCharEqual {
-				currentLine := int(char / TERMINAL_WIDTH)
-				currentChar := int(char % TERMINAL_WIDTH)
-				diff += gotoCharacter(currentChar+1, currentLine+1)
-			}
-			diff += string(newFrame[char])
-			prevCharEqual = false
-			continue
-		}
-		prevCharEqual = true
-	}
+	return getFrameDiffWithWidth(oldFramePtr, newFramePtr, TERMINAL_WIDTH)
+}
 
-	return diff
+// Same as getFrameDiff, for frames that are frameWidth characters wide
+func getFrameDiffWithWidth(oldFramePtr *string, newFramePtr *string, frameWidth int) string {
+	// frames are drawn below the help menu
+	return render.FrameDiff(*oldFramePtr, *newFramePtr, frameWidth, 1)
 }
 
 func gotoCharacter(x int, y int) string {
-	return fmt.Sprintf("\033[%d;%dH", y+1, x)
+	return render.GotoCharacter(x, y)
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Time every still image is shown in a slideshow
+var SLIDESHOW_INTERVAL time.Duration = 5 * time.Second
+
+var IMAGE_EXTENSIONS = []string{".png", ".apng", ".jpg", ".jpeg", ".gif", ".webp", ".bmp"}
+
+// A single frame of an image, shown from start until the next frame starts
+type ImageFrame struct {
+	name   string
+	pixels Frame
+	width  int
+	height int
+	start  time.Duration
+}
+
+// Still images, animated images and slideshows are all played as a sequence of frames.
+// loops is how often the sequence is played, 0 is forever.
+type ImageSequence struct {
+	filepath string
+	frames   []ImageFrame
+	duration time.Duration
+	loops    int
+}
+
+var CURRENT_IMAGES *ImageSequence
+
+func isImage(path string) bool {
+	extension := strings.ToLower(filepath.Ext(path))
+	for _, imageExtension := range IMAGE_EXTENSIONS {
+		if extension == imageExtension {
+			return true
+		}
+	}
+	return false
+}
+
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func loadImages(path string) (*ImageSequence, error) {
+	if isDirectory(path) {
+		return loadSlideshow(path)
+	}
+	decoded, err := decodeImageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	images := &ImageSequence{filepath: path, loops: decoded.loops}
+	addImageFrames(images, filepath.Base(path), decoded)
+	// a still image stays on screen until quitting
+	if len(images.frames) == 1 {
+		images.duration = 0
+		images.loops = 0
+	}
+	return images, nil
+}
+
+// Loads every image in the directory in name order. Still images are shown for SLIDESHOW_INTERVAL,
+// animated images are played once.
+func loadSlideshow(path string) (*ImageSequence, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	images := &ImageSequence{filepath: path, loops: 1}
+	for _, entry := range entries {
+		if entry.IsDir() || !isImage(entry.Name()) {
+			continue
+		}
+		decoded, err := decodeImageFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if len(decoded.frames) == 1 {
+			decoded.delays[0] = SLIDESHOW_INTERVAL
+		}
+		addImageFrames(images, entry.Name(), decoded)
+	}
+	if len(images.frames) == 0 {
+		return nil, errors.New("no images found")
+	}
+	return images, nil
+}
+
+func addImageFrames(images *ImageSequence, name string, decoded *DecodedImage) {
+	for i, frame := range decoded.frames {
+		images.frames = append(images.frames, ImageFrame{
+			name:   name,
+			pixels: toGrayFrame(frame),
+			width:  frame.Bounds().Dx(),
+			height: frame.Bounds().Dy(),
+			start:  images.duration,
+		})
+		images.duration += decoded.delays[i]
+	}
+}
+
+// Transparent pixels end up black, like the terminal background
+func toGrayFrame(img *image.RGBA) Frame {
+	gray := image.NewGray(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+	return Frame(gray.Pix)
+}
+
+// Index of the frame shown at the position
+func imageFrameAt(images *ImageSequence, position time.Duration) int {
+	i := sort.Search(len(images.frames), func(i int) bool {
+		return images.frames[i].start > position
+	})
+	return max(i-1, 0)
+}
+
+// Describes the images as a video, so menus and seek targets work in frames
+func imagesVideo(images *ImageSequence) Video {
+	first := images.frames[0]
+	return Video{
+		filepath:    images.filepath,
+		duration:    images.duration,
+		width:       first.width,
+		height:      first.height,
+		fps:         ANIMATION_FPS,
+		totalFrames: max(int(images.duration.Seconds()*ANIMATION_FPS), 1),
+	}
+}
+
+func playImages() {
+	images := CURRENT_IMAGES
+	// without a terminal nobody can quit, so everything is shown once
+	if !INTERACTIVE && images.loops == 0 {
+		images.loops = 1
+	}
+	timeline := PLAYBACK.(*Timeline)
+	setTerminalDimensions()
+	startInput()
+	PLAYING = true
+	runHook("start")
+
+	var oldFrame *string
+	shownIndex := -1
+	shownFrameNumber := START_FRAME
+	loopsPlayed := 0
+
+	for PLAYING && !QUIT {
+		startFrameTime := time.Now()
+		dimChanged := setTerminalDimensions()
+		handlePlaybackEvents()
+		index := imageFrameAt(images, frameToDuration(timeline.CurrentFrame()))
+		frame := &images.frames[index]
+		if index != shownIndex || dimChanged || FULL_REDRAW || FULL_FRAMES {
+			// snapshots use the dimensions of the shown image
+			CURRENT_VIDEO.width = frame.width
+			CURRENT_VIDEO.height = frame.height
+			newFrame := processFrame(&frame.pixels, frame.width, frame.height, CHANNELS)
+			if oldFrame == nil || dimChanged || FULL_REDRAW || FULL_FRAMES {
+				printFrame(newFrame)
+				FULL_REDRAW = false
+			} else {
+				frameDiff := getFrameDiff(oldFrame, newFrame)
+				printFrame(&frameDiff)
+			}
+			oldFrame = newFrame
+			shownIndex = index
+			shownFrameNumber = timeline.CurrentFrame()
+		}
+
+		if images.duration > 0 {
+			drawMenu()
+		} else {
+			drawImageInfo(frame)
+		}
+		handleSnapshot(shownFrameNumber, &frame.pixels, oldFrame)
+		handleIpcEvents()
+		handleHistory()
+
+		timeline.Advance()
+		waitForNextFrame(startFrameTime)
+		if timeline.CurrentFrame() >= END_FRAME {
+			loopsPlayed++
+			if images.loops != 0 && loopsPlayed >= images.loops {
+				PLAYING = false
+			}
+			timeline.rewind(START_FRAME)
+		}
+	}
+	exit()
+}
+
+// Replaces the menu for still images, which have nothing to seek through
+func drawImageInfo(frame *ImageFrame) {
+	info := fmt.Sprintf("%s  %dx%d", frame.name, frame.width, frame.height) + "\033[K"
+	if message, visible := drawStatusMessage(); visible {
+		info = message
+	}
+	fmt.Print(gotoCharacter(0, TERMINAL_HEIGHT) + info + "\033[0;0H")
+}
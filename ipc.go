@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"cli-video-player/media"
+)
+
+var LOAD_FILE string = ""
+
+// Messages waiting for a client, clients that fall this far behind are disconnected
+const IPC_CLIENT_QUEUE int = 64
+const IPC_WRITE_TIMEOUT = time.Second
+
+// Requests waiting for the play loop, readers wait while it is full
+const IPC_REQUEST_QUEUE int = 64
+
+// Commands and events work like mpv's JSON IPC, so existing scripts only need small changes.
+// Requests look like {"command": ["seek", 10, "relative"], "request_id": 1}.
+type IpcRequest struct {
+	Command   []any `json:"command"`
+	RequestId any   `json:"request_id,omitempty"`
+}
+
+type IpcResponse struct {
+	Error     string `json:"error"`
+	Data      any    `json:"data,omitempty"`
+	RequestId any    `json:"request_id,omitempty"`
+}
+
+type IpcEvent struct {
+	Event string `json:"event"`
+	Name  string `json:"name,omitempty"`
+	Data  any    `json:"data,omitempty"`
+}
+
+// Messages are written by a goroutine per client, so clients that don't read never stall playback
+type IpcClient struct {
+	conn   net.Conn
+	output chan []byte
+}
+
+// A request read from a client, the response goes back to the same client
+type IpcCommand struct {
+	client  *IpcClient
+	request IpcRequest
+}
+
+type IpcServer struct {
+	path      string
+	listener  net.Listener
+	clients   map[*IpcClient]bool
+	mutex     sync.Mutex
+	accepting chan struct{}
+	writers   sync.WaitGroup
+	// requests are run by the play loop, like keys are
+	commands chan IpcCommand
+	// last reported state, events are sent when it changes
+	second int
+	speed  float64
+}
+
+var IPC *IpcServer
+
+var IPC_PROPERTIES = []string{"pause", "time-pos", "duration", "percent-pos", "speed", "path", "frame", "frame-count"}
+
+func startIpcServer(path string) error {
+	// a socket left behind by a crashed player would block listening
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	IPC = &IpcServer{path: path, listener: listener, clients: map[*IpcClient]bool{}, accepting: make(chan struct{}), commands: make(chan IpcCommand, IPC_REQUEST_QUEUE), speed: PLAYBACK.Speed()}
+	go func() {
+		defer close(IPC.accepting)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			client := &IpcClient{conn: conn, output: make(chan []byte, IPC_CLIENT_QUEUE)}
+			IPC.mutex.Lock()
+			IPC.clients[client] = true
+			IPC.mutex.Unlock()
+			IPC.writers.Add(1)
+			go writeIpcClient(IPC, client)
+			go readIpcClient(IPC, client)
+		}
+	}()
+	return nil
+}
+
+// Sends the messages that are still queued, like the response to quit, and closes the socket
+func stopIpcServer() {
+	if IPC == nil {
+		return
+	}
+	IPC.listener.Close()
+	<-IPC.accepting
+	IPC.mutex.Lock()
+	for client := range IPC.clients {
+		IPC.removeClient(client)
+	}
+	IPC.mutex.Unlock()
+	IPC.writers.Wait()
+	os.Remove(IPC.path)
+}
+
+func writeIpcClient(server *IpcServer, client *IpcClient) {
+	defer server.writers.Done()
+	for data := range client.output {
+		client.conn.SetWriteDeadline(time.Now().Add(IPC_WRITE_TIMEOUT))
+		if _, err := client.conn.Write(data); err != nil {
+			// the reader notices the closed connection and removes the client
+			client.conn.Close()
+		}
+	}
+	client.conn.Close()
+}
+
+func readIpcClient(server *IpcServer, client *IpcClient) {
+	conn := client.conn
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var request IpcRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			server.send(client, IpcResponse{Error: "invalid json"})
+			continue
+		}
+		select {
+		case server.commands <- IpcCommand{client, request}:
+		case <-server.accepting:
+			// the server stopped, nothing runs the request anymore
+		}
+	}
+	server.mutex.Lock()
+	server.removeClient(client)
+	server.mutex.Unlock()
+}
+
+// Queues the message without waiting for the client
+func (server *IpcServer) send(client *IpcClient, message any) {
+	data, _ := json.Marshal(message)
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if !server.clients[client] {
+		return
+	}
+	select {
+	case client.output <- append(data, '\n'):
+	default:
+		// the client stopped reading
+		server.removeClient(client)
+	}
+}
+
+// Stops writing to the client once its queue is sent. Called with the lock held.
+func (server *IpcServer) removeClient(client *IpcClient) {
+	if server.clients[client] {
+		delete(server.clients, client)
+		close(client.output)
+	}
+}
+
+func emitIpcEvent(event IpcEvent) {
+	if IPC == nil {
+		return
+	}
+	IPC.mutex.Lock()
+	clients := make([]*IpcClient, 0, len(IPC.clients))
+	for client := range IPC.clients {
+		clients = append(clients, client)
+	}
+	IPC.mutex.Unlock()
+	for _, client := range clients {
+		IPC.send(client, event)
+	}
+}
+
+// Runs the requests clients sent since the last frame and answers them. Runs every frame.
+func handleIpcCommands(server *IpcServer) {
+	for {
+		select {
+		case command := <-server.commands:
+			response := IpcResponse{Error: "success", RequestId: command.request.RequestId}
+			data, err := runIpcCommand(command.request.Command)
+			if err != nil {
+				response.Error = err.Error()
+			}
+			response.Data = data
+			server.send(command.client, response)
+		default:
+			return
+		}
+	}
+}
+
+// Runs a command like the keyboard does, the play loop reports the changes
+func runIpcCommand(command []any) (any, error) {
+	if len(command) == 0 {
+		return nil, errors.New("invalid parameter")
+	}
+	name, _ := command[0].(string)
+	args := command[1:]
+
+	switch name {
+	case "quit":
+		// the play loop exits, the response is sent before the socket is closed
+		QUIT = true
+		return nil, nil
+	case "get_property":
+		if len(args) < 1 {
+			return nil, errors.New("invalid parameter")
+		}
+		property, _ := args[0].(string)
+		return getIpcProperty(property)
+	case "set_property":
+		if len(args) < 2 {
+			return nil, errors.New("invalid parameter")
+		}
+		property, _ := args[0].(string)
+		return nil, setIpcProperty(property, args[1])
+	case "cycle":
+		if len(args) < 1 || args[0] != "pause" {
+			return nil, errors.New("invalid parameter")
+		}
+		togglePause()
+		return nil, nil
+	case "seek":
+		if len(args) < 1 {
+			return nil, errors.New("invalid parameter")
+		}
+		value, ok := args[0].(float64)
+		if !ok {
+			return nil, errors.New("invalid parameter")
+		}
+		mode := "relative"
+		if len(args) > 1 {
+			mode, _ = args[1].(string)
+		}
+		return nil, ipcSeek(value, mode)
+	case "loadfile":
+		if len(args) < 1 {
+			return nil, errors.New("invalid parameter")
+		}
+		path, _ := args[0].(string)
+		if _, err := os.Stat(path); err != nil && !media.IsLavfi(path) && !media.IsUrl(path) {
+			return nil, errors.New("file not found")
+		}
+		if CURRENT_ANIMATION != nil || CURRENT_IMAGES != nil || CURRENT_VIDEO.stream != nil {
+			return nil, errors.New("loading files is only supported while playing a video")
+		}
+		LOAD_FILE = path
+		return nil, nil
+	}
+	return nil, errors.New("unknown command")
+}
+
+func ipcSeek(value float64, mode string) error {
+	var frame int
+	switch mode {
+	case "relative":
+		frame = currentFrame() + int(value*CURRENT_VIDEO.fps)
+	case "absolute":
+		frame = int(value * CURRENT_VIDEO.fps)
+	case "absolute-percent", "relative-percent":
+		if CURRENT_VIDEO.totalFrames == 0 {
+			return errors.New("percentages need a known duration")
+		}
+		frame = int(float64(CURRENT_VIDEO.totalFrames) * value / 100)
+		if mode == "relative-percent" {
+			frame += currentFrame()
+		}
+	default:
+		return errors.New("invalid parameter")
+	}
+	seekTo(frame)
+	return nil
+}
+
+func getIpcProperty(property string) (any, error) {
+	video := &CURRENT_VIDEO
+	frame := currentFrame()
+	switch property {
+	case "pause":
+		return paused(), nil
+	case "time-pos":
+		return float64(frame) / video.fps, nil
+	case "duration":
+		if video.duration == 0 {
+			return nil, errors.New("property unavailable")
+		}
+		return video.duration.Seconds(), nil
+	case "percent-pos":
+		if video.totalFrames == 0 {
+			return nil, errors.New("property unavailable")
+		}
+		return float64(frame) / float64(video.totalFrames) * 100, nil
+	case "speed":
+		return PLAYBACK.Speed(), nil
+	case "path":
+		return video.filepath, nil
+	case "frame":
+		return frame, nil
+	case "frame-count":
+		return video.totalFrames, nil
+	}
+	return nil, errors.New("property not found")
+}
+
+func setIpcProperty(property string, value any) error {
+	switch property {
+	case "pause":
+		paused, ok := value.(bool)
+		if !ok {
+			return errors.New("invalid parameter")
+		}
+		if paused {
+			PLAYBACK.Pause()
+		} else {
+			PLAYBACK.Play()
+		}
+	case "speed":
+		speed, ok := value.(float64)
+		if !ok || speed < 0.01 || speed > 100 {
+			return errors.New("invalid parameter")
+		}
+		PLAYBACK.SetSpeed(speed)
+	case "time-pos":
+		seconds, ok := value.(float64)
+		if !ok {
+			return errors.New("invalid parameter")
+		}
+		return ipcSeek(seconds, "absolute")
+	default:
+		for _, known := range IPC_PROPERTIES {
+			if known == property {
+				return errors.New("property is read-only")
+			}
+		}
+		return errors.New("property not found")
+	}
+	return nil
+}
+
+// Runs the received requests and sends events for changes since the last frame,
+// pauses and seeks are reported when they happen. Runs every frame.
+func handleIpcEvents() {
+	server := IPC
+	if server == nil {
+		return
+	}
+	handleIpcCommands(server)
+	if speed := PLAYBACK.Speed(); speed != server.speed {
+		server.speed = speed
+		emitIpcEvent(IpcEvent{Event: "property-change", Name: "speed", Data: speed})
+	}
+	// time-pos is reported once per second of playback, and after seeking
+	position := float64(currentFrame()) / CURRENT_VIDEO.fps
+	if second := int(position); second != server.second {
+		server.second = second
+		emitIpcEvent(IpcEvent{Event: "property-change", Name: "time-pos", Data: position})
+	}
+}
+
+// Replaces the playing video with the one requested through loadfile
+func handleLoadFile() bool {
+	if LOAD_FILE == "" {
+		return false
+	}
+	path := LOAD_FILE
+	LOAD_FILE = ""
+	return replaceVideo(path)
+}
+
+// Reports a seek, the player decodes from the new position before the next frame is shown
+func emitIpcSeek() {
+	emitIpcEvent(IpcEvent{Event: "seek"})
+	emitIpcEvent(IpcEvent{Event: "playback-restart"})
+}
+
+func emitIpcPause(paused bool) {
+	if paused {
+		emitIpcEvent(IpcEvent{Event: "pause"})
+	} else {
+		emitIpcEvent(IpcEvent{Event: "unpause"})
+	}
+	emitIpcEvent(IpcEvent{Event: "property-change", Name: "pause", Data: paused})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIpcCommandsRunOnPlayLoop(t *testing.T) {
+	video := Video{filepath: "video.mp4", fps: 10, totalFrames: 100, duration: 10 * time.Second}
+	oldVideo, oldPlayback, oldIpc := CURRENT_VIDEO, PLAYBACK, IPC
+	defer func() {
+		CURRENT_VIDEO, PLAYBACK, IPC, QUIT = oldVideo, oldPlayback, oldIpc, false
+	}()
+	CURRENT_VIDEO = video
+	PLAYBACK = newTimeline(&video, 25)
+
+	path := filepath.Join(t.TempDir(), "ipc.sock")
+	if err := startIpcServer(path); err != nil {
+		t.Fatalf("startIpcServer: %v", err)
+	}
+	defer stopIpcServer()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte(`{"command": ["get_property", "frame"], "request_id": 1}` + "\n" + `{"command": ["quit"], "request_id": 2}` + "\n"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(IPC.commands) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the requests weren't queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if QUIT {
+		t.Fatal("quit ran before the play loop handled it")
+	}
+	handleIpcEvents()
+	if !QUIT {
+		t.Error("quit didn't stop the play loop")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+	var responses []IpcResponse
+	for len(responses) < 2 {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("reading the responses: %v", err)
+		}
+		var message map[string]any
+		json.Unmarshal(line, &message)
+		// events are sent to every client, responses have a request id
+		if _, isEvent := message["event"]; isEvent {
+			continue
+		}
+		var response IpcResponse
+		json.Unmarshal(line, &response)
+		responses = append(responses, response)
+	}
+	if responses[0].RequestId != 1.0 || responses[0].Error != "success" || responses[0].Data != 25.0 {
+		t.Errorf("get_property answered %+v, want frame 25 for request 1", responses[0])
+	}
+	if responses[1].RequestId != 2.0 || responses[1].Error != "success" {
+		t.Errorf("quit answered %+v, want success for request 2", responses[1])
+	}
+}
+
+func TestPostStatusMessage(t *testing.T) {
+	defer func() { STATUS_MESSAGE = "" }()
+	done := make(chan struct{})
+	go func() {
+		postStatusMessage("peer joined")
+		close(done)
+	}()
+	<-done
+	message, visible := drawStatusMessage()
+	if !visible || message != YELLOW_COLOR+"peer joined"+RESET_COLOR+"\033[K" {
+		t.Errorf("drawStatusMessage returned %q, want the posted message", message)
+	}
+}
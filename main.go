@@ -4,139 +4,567 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"cli-video-player/media"
+	"cli-video-player/player"
+	"cli-video-player/render"
 	"golang.org/x/term"
 )
 
-const (
+const RESET_COLOR string = "\033[0m"
+
+// Colors and the derived strings below can be changed in the config file
+var (
 	YELLOW_COLOR string = "\033[33m"
 	BLUE_COLOR   string = "\033[34m"
 	CYAN_COLOR   string = "\033[36m"
-	RESET_COLOR  string = "\033[0m"
 	ORANGE_COLOR string = "\033[38;5;208m"
 	RED_COLOR    string = "\033[31m"
 )
-const (
-	BUTTON_BACK_H    = ORANGE_COLOR + "[" + YELLOW_COLOR + "<" + ORANGE_COLOR + "]" + RESET_COLOR
-	BUTTON_BACK      = "[<]"
-	BUTTON_FORWARD_H = ORANGE_COLOR + "[" + YELLOW_COLOR + ">" + ORANGE_COLOR + "]" + RESET_COLOR
-	BUTTON_FORWARD   = "[>]"
-	BUTTON_PLAYING   = "  ||  "
-	BUTTON_PAUSED    = YELLOW_COLOR + "  ||  " + RESET_COLOR
-	HELP_MENU        = "[q]uit  pause[spacebar, k]  backwards[j, <]  forward[l, >]  goto[0-9]"
+var (
+	BUTTON_BACK_H    string
+	BUTTON_BACK      string
+	BUTTON_FORWARD_H string
+	BUTTON_FORWARD   string
+	BUTTON_PLAYING   string
+	BUTTON_PAUSED    string
+	BUTTON_REVERSE   string
+	BUTTON_BUFFERING string
+	BUTTON_RECONNECT string
+	HELP_MENU        string
+	PREFIX           string
 )
 
 const PREFIX_TEXT = "VideoPlayer:"
-const PREFIX string = YELLOW_COLOR + PREFIX_TEXT + RESET_COLOR
-const BUFFER_SIZE int = 15
-const BUFFER_OFFSET int = 30
-const SKIP_AMOUNT_S int = 10
-const CHANNELS = 1
-
-// const DEFAULT_ASCII string = "$@B%8&WM#*oahkbdpqwmZO0QLCJUYXzcvunxrjft/()1{}[]?-_+~<>i!lI;:,^`'. "
-const DEFAULT_ASCII string = "%@#*+=-:. "
+const CHANNELS = media.CHANNELS
+
+var BUFFER_SIZE int = 15
+var BUFFER_OFFSET int = 30
+
+var SKIP_AMOUNT_S int = 10
+
+var DEFAULT_ASCII string = render.DEFAULT_CHARACTERS
+var GAMMA float64 = render.DEFAULT_GAMMA
+
 const EDGE_ASCII string = " .*@"
 
 var CURRENT_VIDEO Video
 var TERMINAL_WIDTH int
 var TERMINAL_HEIGHT int
 var PLAYING bool
-var PAUSED bool
+
+// Set to leave the play loop from other goroutines, like the IPC socket
+var QUIT bool = false
+
+// First error that stopped playback, reported once the terminal is restored
+var PLAYBACK_ERROR error
+var PLAYBACK_ERROR_MUTEX sync.Mutex
+
+// State of the terminal before input was read raw
+var TERMINAL_STATE *term.State
+
 var DIM_CHANGE_DURING_PAUSE bool = false
-var SKIP_BACKWARD bool = false
-var SKIP_FORWARD bool = false
-var GOTO bool = false
-var GOTOPOS int = 0
+var FULL_REDRAW bool = false
+var INTERACTIVE bool = true
+var FIXED_SIZE bool = false
+var FAST bool = false
+var FULL_FRAMES bool = false
+var EXIT_CODE int = 0
+var INPUT *os.File = os.Stdin
+
+// Direction of the last skip, its button lights up on the next menu
+var SKIPPED int = 0
+var START_FRAME int = 0
+var END_FRAME int = 0
+
+// Videos played after the current one
+var PLAYLIST []string
 
 func main() {
-	if len(os.Args) < 2 {
+	// settings from the config file and environment become the defaults of the flags
+	config, configErr := loadConfig(configPath())
+	applyConfig(config)
+
+	// without a terminal there is no input and no size to follow
+	INTERACTIVE = term.IsTerminal(int(os.Stdout.Fd()))
+	if !INTERACTIVE {
+		TERMINAL_WIDTH = 80
+		TERMINAL_HEIGHT = 24
+		FIXED_SIZE = true
+	}
+
+	args := os.Args[1:]
+	command, isCommand := Command{}, false
+	if len(args) > 0 {
+		command, isCommand = findCommand(args[0])
+	}
+	// the config command explains what is wrong with the config
+	if configErr != nil && !(isCommand && command.name == "config") {
+		printError("Invalid config '"+configPath()+"':", configErr)
+		fmt.Println(strings.Repeat(" ", len(PREFIX_TEXT)), "Run 'play config' to check it.")
+		os.Exit(EXIT_CODE)
+	}
+	if isCommand {
+		command.run(args[1:])
+	} else {
+		runPlay(args)
+	}
+	os.Exit(EXIT_CODE)
+}
+
+func runPlay(args []string) {
+	flags := newFlagSet("")
+	start := flags.String("start", "", "position to start playing from (e.g. 1:23, 90s, 45%, #1234)")
+	end := flags.String("end", "", "position to stop playing at (e.g. 1:23, 90s, 45%, #1234)")
+	snapshotAt := flags.String("snapshot-at", "", "save a snapshot at the position and exit (e.g. 1:23, 90s, 45%, #1234)")
+	flags.StringVar(&SNAPSHOT_DIR, "snapshot-dir", SNAPSHOT_DIR, "directory snapshots are saved to")
+	flags.IntVar(&ANSI_BAUD_RATE, "baud", ANSI_BAUD_RATE, "emulated baud rate for .ans animations, 0 shows them at once")
+	size := flags.String("size", "", "render at a fixed size of COLSxROWS instead of the terminal size")
+	flags.BoolVar(&FAST, "fast", FAST, "output frames as fast as possible instead of in real time")
+	flags.BoolVar(&FULL_FRAMES, "full-frames", FULL_FRAMES, "output every frame completely instead of only the changes")
+	flags.DurationVar(&SLIDESHOW_INTERVAL, "interval", SLIDESHOW_INTERVAL, "time each still image is shown when playing a directory of images")
+	host := flags.String("host", "", "host a watch-together session on the address (e.g. :7000), others follow pauses and seeks")
+	join := flags.String("join", "", "join the watch-together session at the address (e.g. 192.168.1.5:7000)")
+	name := flags.String("name", defaultSyncName(), "name shown to others in a watch-together session")
+	ipcSocket := flags.String("ipc-socket", "", "accept JSON commands on a unix socket at the path, like mpv's --input-ipc-server")
+	resume := flags.Bool("resume", false, "continue where the video was stopped last time without asking")
+	noResume := flags.Bool("no-resume", false, "start from the beginning without asking to continue")
+	noHistory := flags.Bool("no-history", !HISTORY_ENABLED, "don't add the played files to the history")
+	source := flags.String("source", "", "play a generated source instead of a file (e.g. lavfi:testsrc2, lavfi:mandelbrot=size=vga:duration=20)")
+	paths, ok := parseFlags(flags, args)
+	if !ok {
+		return
+	}
+
+	if *size != "" {
+		width, height, err := parseSize(*size)
+		if err != nil {
+			printUsageError("play", "Invalid --size:", err)
+			return
+		}
+		TERMINAL_WIDTH = width
+		TERMINAL_HEIGHT = height
+		FIXED_SIZE = true
+	}
+	if *resume && *noResume {
+		printUsageError("play", "--resume and --no-resume can't be combined.")
+		return
+	}
+	HISTORY_ENABLED = !*noHistory
+	if *resume {
+		RESUME_MODE = "always"
+	} else if *noResume {
+		RESUME_MODE = "never"
+	}
+	if *source != "" {
+		if !media.IsLavfi(*source) {
+			printUsageError("play", "Invalid --source: sources have to start with '"+media.LAVFI_PREFIX+"'.")
+			return
+		}
+		if len(paths) > 0 {
+			printUsageError("play", "--source can't be combined with files.")
+			return
+		}
+		paths = []string{*source}
+	}
+	if len(paths) < 1 {
 		fmt.Println()
 		fmt.Println(PREFIX, "Run 'play <video_path>' to play a video,")
-		fmt.Println(strings.Repeat(" ", len(PREFIX_TEXT)), "for example: 'play video.mp4'.")
+		fmt.Println(strings.Repeat(" ", len(PREFIX_TEXT)), "for example: 'play video.mp4'. Run 'play --help' for more.")
 		return
 	}
+	if len(paths) > 1 {
+		if *start != "" || *end != "" || *snapshotAt != "" {
+			printUsageError("play", "--start, --end and --snapshot-at only work with a single file.")
+			return
+		}
+		for _, path := range paths {
+			if _, err := os.Stat(path); err != nil && !media.IsLavfi(path) && !media.IsUrl(path) {
+				printError("File '" + path + "' could not be found.")
+				return
+			}
+		}
+	}
+	path := paths[0]
+	PLAYLIST = paths[1:]
 
-	if os.Args[1] == "test" {
-		runTests(os.Args[2])
+	if media.IsLavfi(path) {
+		if _, err := media.ParseLavfiSource(path); err != nil {
+			printError("'"+path+"' is not a valid source:", err)
+			return
+		}
+		CURRENT_VIDEO = loadVideo(path)
+	} else if media.IsUrl(path) {
+		CURRENT_VIDEO = loadVideo(path)
+		if CURRENT_VIDEO.fps == 0 {
+			printError("'" + path + "' is not a valid video stream.")
+			return
+		}
+		// live streams have no duration and can't be seeked with ffmpeg
+		if CURRENT_VIDEO.duration == 0 {
+			CURRENT_VIDEO = openStream(path)
+			if CURRENT_VIDEO.fps == 0 {
+				printError("'" + path + "' is not a valid video stream.")
+				return
+			}
+			go readStream(&CURRENT_VIDEO)
+		}
+	} else if isStream(path) {
+		CURRENT_VIDEO = openStream(path)
+		if CURRENT_VIDEO.fps == 0 {
+			printError("'" + path + "' is not a valid video stream.")
+			return
+		}
+		go readStream(&CURRENT_VIDEO)
+		// the video is read from stdin, so keys have to come from the terminal itself
+		if path == "-" {
+			INPUT = openTerminalInput()
+		}
+	} else if _, err := os.Stat(path); err != nil {
+		printError("File '" + path + "' could not be found.")
 		return
+	} else if isImage(path) || isDirectory(path) {
+		images, err := loadImages(path)
+		if err != nil {
+			printError("'"+path+"' could not be shown:", err)
+			return
+		}
+		CURRENT_IMAGES = images
+		CURRENT_VIDEO = imagesVideo(images)
+	} else if isAnimation(path) {
+		animation, err := loadAnimation(path)
+		if err != nil {
+			printError("'"+path+"' is not a valid animation:", err)
+			return
+		}
+		CURRENT_ANIMATION = animation
+		CURRENT_VIDEO = animationVideo(animation)
+	} else {
+		CURRENT_VIDEO = loadVideo(path)
+		if CURRENT_VIDEO.fps == 0 {
+			printError("'" + path + "' is not a valid video.")
+			return
+		}
 	}
 
-	if _, err := os.Stat(os.Args[1]); err != nil {
-		fmt.Println(PREFIX, "File '"+os.Args[1]+"' could not be found.")
+	END_FRAME = CURRENT_VIDEO.totalFrames
+	if CURRENT_VIDEO.totalFrames == 0 {
+		// the length of streams is unknown until they end
+		END_FRAME = math.MaxInt
+	}
+	if *start != "" {
+		frame, err := parseSeekTarget(*start, &CURRENT_VIDEO)
+		if err != nil {
+			printError("Invalid --start:", err)
+			return
+		}
+		START_FRAME = frame
+	}
+	if *end != "" {
+		frame, err := parseSeekTarget(*end, &CURRENT_VIDEO)
+		if err != nil {
+			printError("Invalid --end:", err)
+			return
+		}
+		END_FRAME = frame
+	}
+	if START_FRAME >= END_FRAME {
+		printError("--start has to be before --end.")
+		return
+	}
+	if len(PLAYLIST) > 0 && (CURRENT_ANIMATION != nil || CURRENT_IMAGES != nil || CURRENT_VIDEO.stream != nil) {
+		printUsageError("play", "Only videos can be played one after another.")
 		return
 	}
-	CURRENT_VIDEO = loadVideo(os.Args[1], BUFFER_OFFSET*2)
-	if CURRENT_VIDEO.fps == 0 {
-		fmt.Println(PREFIX, "'"+os.Args[1]+"' is not a valid video.")
+	if (*host != "" || *join != "") && (CURRENT_ANIMATION != nil || CURRENT_IMAGES != nil) {
+		printError("Watch-together sessions are only supported for videos.")
+		return
+	}
+	// followers of a watch-together session start where the host is
+	if CURRENT_ANIMATION == nil && CURRENT_IMAGES == nil && *snapshotAt == "" && *join == "" {
+		REMEMBER_POSITION = canRememberPosition(&CURRENT_VIDEO)
+		if REMEMBER_POSITION && *start == "" {
+			RESUME_FRAME = resumeFrame(&CURRENT_VIDEO)
+		}
+	}
+	if CURRENT_ANIMATION != nil || CURRENT_IMAGES != nil {
+		PLAYBACK = newTimeline(&CURRENT_VIDEO, START_FRAME)
+	} else {
+		// reverse playback still stops at START_FRAME when resuming
+		frame := START_FRAME
+		if RESUME_FRAME > START_FRAME && RESUME_FRAME < END_FRAME {
+			frame = RESUME_FRAME
+		}
+		videoPlayer, err := openVideoPlayer(&CURRENT_VIDEO, frame)
+		if err != nil {
+			printError("'"+path+"' could not be played:", err)
+			return
+		}
+		PLAYBACK = videoPlayer
+	}
+	if *ipcSocket != "" {
+		if err := startIpcServer(*ipcSocket); err != nil {
+			printError("Could not open the IPC socket '"+*ipcSocket+"':", err)
+			return
+		}
+	}
+	if *host != "" {
+		if err := hostSync(*host, *name); err != nil {
+			printError("Could not host on '"+*host+"':", err)
+			return
+		}
+	} else if *join != "" {
+		if err := joinSync(*join, *name); err != nil {
+			printError("Could not join '"+*join+"':", err)
+			return
+		}
+	}
+	if *snapshotAt == "" {
+		startWatching(path)
+	}
+	if CURRENT_ANIMATION == nil && CURRENT_IMAGES == nil {
+		loadBookmarks(&CURRENT_VIDEO)
+	}
+	if CURRENT_ANIMATION != nil {
+		if *snapshotAt != "" {
+			printError("--snapshot-at is not supported for animations.")
+			return
+		}
+		playAnimation()
+		return
+	}
+	if CURRENT_IMAGES != nil {
+		if *snapshotAt != "" {
+			printError("--snapshot-at is not supported for images.")
+			return
+		}
+		playImages()
+		return
+	}
+	if *snapshotAt != "" {
+		frameNumber, err := parseSeekTarget(*snapshotAt, &CURRENT_VIDEO)
+		if err != nil {
+			printError("Invalid --snapshot-at:", err)
+			return
+		}
+		setTerminalDimensions()
+		seekTo(frameNumber)
+		frame, exists := waitForFrame(videoPlayer())
+		if !exists {
+			printError("Could not decode a frame at '" + *snapshotAt + "'.")
+			return
+		}
+		ascii := processFrame(&frame, CURRENT_VIDEO.width, CURRENT_VIDEO.height, CHANNELS)
+		snapshotPath, err := saveSnapshot(&CURRENT_VIDEO, frameNumber, &frame, ascii, TERMINAL_WIDTH, TERMINAL_HEIGHT-3, SNAPSHOT_DIR)
+		if err != nil {
+			printError("Could not save snapshot:", err)
+			return
+		}
+		fmt.Println(PREFIX, "Snapshot saved to '"+snapshotPath+".{txt,ans,png}'.")
 		return
 	}
 	playVideo()
 }
 
+// Builds the buttons, help menu and prefix from the current colors and keybindings
+func buildMenuStrings() {
+	BUTTON_BACK_H = ORANGE_COLOR + "[" + YELLOW_COLOR + "<" + ORANGE_COLOR + "]" + RESET_COLOR
+	BUTTON_BACK = "[<]"
+	BUTTON_FORWARD_H = ORANGE_COLOR + "[" + YELLOW_COLOR + ">" + ORANGE_COLOR + "]" + RESET_COLOR
+	BUTTON_FORWARD = "[>]"
+	BUTTON_PLAYING = "  ||  "
+	BUTTON_PAUSED = YELLOW_COLOR + "  ||  " + RESET_COLOR
+	BUTTON_REVERSE = YELLOW_COLOR + "  <<  " + RESET_COLOR
+	BUTTON_BUFFERING = YELLOW_COLOR + "buffering..." + RESET_COLOR
+	BUTTON_RECONNECT = RED_COLOR + "reconnecting" + RESET_COLOR
+	HELP_MENU = buildHelpMenu()
+	PREFIX = YELLOW_COLOR + PREFIX_TEXT + RESET_COLOR
+}
+
 func playVideo() {
-	bufferVideo(&CURRENT_VIDEO, 0, BUFFER_OFFSET)
+	// indexing would download the whole video
+	if CURRENT_VIDEO.stream == nil && !media.IsUrl(CURRENT_VIDEO.filepath) {
+		go buildThumbnailIndex(CURRENT_VIDEO.filepath, CURRENT_VIDEO.width, CURRENT_VIDEO.height, &THUMBNAIL_INDEX)
+	}
 	setTerminalDimensions()
-	go handleInput()
+	startInput()
 	PLAYING = true
-	PAUSED = false
+	PLAYBACK.Play()
+	runHook("start")
 
-	frame, _ := getFrame(&CURRENT_VIDEO)
-	oldFrame := processFrame(frame, CURRENT_VIDEO.width, CURRENT_VIDEO.height, CHANNELS)
-	printFrame(oldFrame)
-	shiftBuffer(&CURRENT_VIDEO)
-	drawMenu()
+	// source frame currently on screen, used for snapshots
+	var shownFrame *Frame
+	var oldFrame *string
+	shownFrameNumber := PLAYBACK.CurrentFrame()
+	// the first frame and the frame after seeking are shown while paused too
+	showFrame := true
 
-	for PLAYING {
+	for PLAYING && !QUIT && playbackError() == nil {
 		startFrameTime := time.Now()
 		dimChanged := setTerminalDimensions()
-		frame, exists := getFrame(&CURRENT_VIDEO)
-		if !PAUSED {
-			if exists {
-				newFrame := processFrame(frame, CURRENT_VIDEO.width, CURRENT_VIDEO.height, CHANNELS)
-				if dimChanged || DIM_CHANGE_DURING_PAUSE {
-					printFrame(newFrame)
-					DIM_CHANGE_DURING_PAUSE = false
-				} else {
-					frameDiff := getFrameDiff(oldFrame, newFrame)
-					printFrame(&frameDiff)
-				}
-				oldFrame = newFrame
-
-				shiftBuffer(&CURRENT_VIDEO)
-				if CURRENT_VIDEO.currentFrame%BUFFER_SIZE == 0 {
-					go bufferVideo(&CURRENT_VIDEO, CURRENT_VIDEO.currentFrame+BUFFER_OFFSET, BUFFER_SIZE)
-				}
-				CURRENT_VIDEO.currentFrame++
-			} else {
+		videoPlayer := videoPlayer()
+		if videoPlayer.CurrentFrame() >= END_FRAME || videoPlayer.Ended() {
+			if !playNextFile() {
+				PLAYING = false
+				break
+			}
+			FULL_REDRAW = true
+			showFrame = true
+			continue
+		}
+		showFrame = handlePlaybackEvents() || showFrame
+		paused := videoPlayer.Paused()
+		if !paused || showFrame {
+			frame, buffered := videoPlayer.Frame()
+			if !buffered {
+				drawMenu()
 				time.Sleep(10 * time.Millisecond)
 				continue
 			}
-		}
-		if PAUSED && dimChanged {
-			frame, _ := getFrame(&CURRENT_VIDEO)
-			oldFrame := processFrame(frame, CURRENT_VIDEO.width, CURRENT_VIDEO.height, CHANNELS)
+			newFrame := processFrame(&frame, CURRENT_VIDEO.width, CURRENT_VIDEO.height, CHANNELS)
+			if oldFrame == nil || dimChanged || DIM_CHANGE_DURING_PAUSE || FULL_REDRAW || FULL_FRAMES {
+				printFrame(newFrame)
+				DIM_CHANGE_DURING_PAUSE = false
+				FULL_REDRAW = false
+			} else {
+				frameDiff := getFrameDiff(oldFrame, newFrame)
+				printFrame(&frameDiff)
+			}
+			oldFrame = newFrame
+			shownFrame = &frame
+			shownFrameNumber = videoPlayer.CurrentFrame()
+			showFrame = false
+
+			// reverse playback stops at the start of the video
+			if !paused && videoPlayer.Reverse() && shownFrameNumber <= START_FRAME {
+				videoPlayer.Pause()
+				videoPlayer.SetReverse(false)
+			} else if !paused {
+				videoPlayer.Advance()
+			}
+		} else if dimChanged || FULL_REDRAW {
+			// the frame on screen is drawn again at the new size
+			oldFrame = processFrame(shownFrame, CURRENT_VIDEO.width, CURRENT_VIDEO.height, CHANNELS)
 			printFrame(oldFrame)
 			DIM_CHANGE_DURING_PAUSE = true
+			FULL_REDRAW = false
 		}
 
 		drawMenu()
-		handleGoto()
-		handleSkip()
-
-		var deltaTime time.Duration = time.Now().Sub(startFrameTime)
-		time.Sleep((time.Second / time.Duration(CURRENT_VIDEO.fps)) - deltaTime)
-		if CURRENT_VIDEO.currentFrame == CURRENT_VIDEO.totalFrames {
-			PLAYING = false
+		handleSnapshot(shownFrameNumber, shownFrame, oldFrame)
+		handleSync()
+		handleIpcEvents()
+		handleHistory()
+		if handleLoadFile() {
+			FULL_REDRAW = true
+			showFrame = true
 		}
+
+		waitForNextFrame(startFrameTime)
 	}
 	exit()
 }
 
+// Waits until the frame at the position of the player is decoded, false when there is none
+func waitForFrame(videoPlayer *player.Player) (Frame, bool) {
+	for {
+		if frame, buffered := videoPlayer.Frame(); buffered {
+			return frame, true
+		}
+		if videoPlayer.Ended() {
+			return nil, false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Switches to another video without leaving playback, returns false if it can't be played
+func replaceVideo(path string) bool {
+	video := loadVideo(path)
+	if video.fps == 0 || video.duration == 0 {
+		if video.decoder != nil {
+			video.decoder.Close()
+		}
+		setStatusMessage(fmt.Sprintf("'%s' is not a valid video", path))
+		return false
+	}
+	if watchedToEnd(&CURRENT_VIDEO) {
+		runHook("end")
+	}
+	savePosition(&CURRENT_VIDEO)
+	recordHistory(&CURRENT_VIDEO)
+	emitIpcEvent(IpcEvent{Event: "end-file"})
+
+	// there is no asking in the middle of playback
+	frame := 0
+	REMEMBER_POSITION = canRememberPosition(&video)
+	if REMEMBER_POSITION && RESUME_MODE == "always" {
+		frame = max(resumeFrame(&video), 0)
+	}
+	videoPlayer, err := openVideoPlayer(&video, frame)
+	if err != nil {
+		setStatusMessage(fmt.Sprintf("'%s' is not a valid video", path))
+		return false
+	}
+	// the old player stops decoding, the new one plays with the same settings
+	oldPlayer := PLAYBACK
+	videoPlayer.SetSpeed(oldPlayer.Speed())
+	oldPlayer.(*player.Player).Close()
+	CURRENT_VIDEO = video
+	PLAYBACK = videoPlayer
+	START_FRAME = 0
+	END_FRAME = CURRENT_VIDEO.totalFrames
+	resetThumbnailIndex(&THUMBNAIL_INDEX, path)
+	startWatching(path)
+	loadBookmarks(&CURRENT_VIDEO)
+	closeBookmarkPrompt()
+	if !media.IsUrl(path) {
+		go buildThumbnailIndex(CURRENT_VIDEO.filepath, CURRENT_VIDEO.width, CURRENT_VIDEO.height, &THUMBNAIL_INDEX)
+	}
+	videoPlayer.Play()
+	emitIpcEvent(IpcEvent{Event: "file-loaded"})
+	runHook("start")
+	if oldPlayer.Paused() {
+		videoPlayer.Pause()
+	}
+	return true
+}
+
+// Continues with the next video of the playlist, videos that can't be played are skipped
+func playNextFile() bool {
+	for len(PLAYLIST) > 0 {
+		path := PLAYLIST[0]
+		PLAYLIST = PLAYLIST[1:]
+		if replaceVideo(path) {
+			return true
+		}
+	}
+	return false
+}
+
 func drawMenu() {
+	menu := renderMenu()
+	SKIPPED = 0
+
+	preview, visible := drawPreview()
+	if PREVIEW_VISIBLE && !visible {
+		// the video underneath the popup has to be redrawn
+		FULL_REDRAW = true
+	}
+	PREVIEW_VISIBLE = visible
+
+	fmt.Print(menu + preview + "\033[0;0H")
+}
+
+// Builds the menubar and progressbar at the bottom of the screen
+func renderMenu() string {
 	var runtime = int(CURRENT_VIDEO.duration.Seconds())
-	var currentTime = int(((time.Second / time.Duration(CURRENT_VIDEO.fps)) * time.Duration(CURRENT_VIDEO.currentFrame)).Seconds())
+	var currentTime = int(((time.Second / time.Duration(CURRENT_VIDEO.fps)) * time.Duration(currentFrame())).Seconds())
 	currentMinutes := currentTime / 60
 	currentSeconds := currentTime % 60
 	endMinutes := runtime / 60
@@ -146,24 +574,34 @@ func drawMenu() {
 	var currentTimeText string = fmt.Sprintf(BLUE_COLOR+"["+CYAN_COLOR+"%d:%02d"+BLUE_COLOR+"]"+RESET_COLOR, currentMinutes, currentSeconds)
 	var endTimeWidth int = len(fmt.Sprintf("[%02d:%02d]", endMinutes, endSeconds))
 	var endTime string = fmt.Sprintf(BLUE_COLOR+"["+CYAN_COLOR+"%02d:%02d"+BLUE_COLOR+"]"+RESET_COLOR, endMinutes, endSeconds)
+	if runtime == 0 {
+		endTime = BLUE_COLOR + "[" + CYAN_COLOR + "--:--" + BLUE_COLOR + "]" + RESET_COLOR
+	}
 
 	var buttonsWidth int = 12
 	var buttons string = ""
-	if SKIP_BACKWARD {
+	if SKIPPED < 0 {
 		buttons += BUTTON_BACK_H
 	} else {
 		buttons += BUTTON_BACK
 	}
-	if PAUSED {
+	if paused() {
 		buttons += BUTTON_PAUSED
+	} else if PLAYBACK.Reverse() {
+		buttons += BUTTON_REVERSE
 	} else {
 		buttons += BUTTON_PLAYING
 	}
-	if SKIP_FORWARD {
+	if SKIPPED > 0 {
 		buttons += BUTTON_FORWARD_H
 	} else {
 		buttons += BUTTON_FORWARD
 	}
+	if RECONNECTING.Load() {
+		buttons = BUTTON_RECONNECT
+	} else if videoPlayer := videoPlayer(); videoPlayer != nil && videoPlayer.Buffering() {
+		buttons = BUTTON_BUFFERING
+	}
 	var spacingWidth float64 = float64(TERMINAL_WIDTH-currentTimeWidth-endTimeWidth-buttonsWidth) / 2
 	var oddSpacing bool = spacingWidth-math.Floor(spacingWidth) >= 0.5
 	var spacing string = strings.Repeat(" ", int(spacingWidth))
@@ -171,9 +609,12 @@ func drawMenu() {
 	var progressProcent float64 = float64(currentTime) / float64(runtime)
 	var progressChars int = int((float64(TERMINAL_WIDTH) - 2) * progressProcent)
 	var progressbar string = BLUE_COLOR + "[" + CYAN_COLOR
+	bookmarks := bookmarkColumns(TERMINAL_WIDTH-2, CURRENT_VIDEO.duration.Seconds())
 
 	for i := 0; i < TERMINAL_WIDTH-2; i++ {
-		if progressChars >= i {
+		if bookmarks[i] {
+			progressbar += YELLOW_COLOR + "◆" + CYAN_COLOR
+		} else if progressChars >= i {
 			progressbar += "■"
 		} else {
 			progressbar += "□"
@@ -187,91 +628,232 @@ func drawMenu() {
 		menubar = currentTimeText + spacing + buttons + spacing + endTime
 	}
 	progressbar += BLUE_COLOR + "]" + RESET_COLOR
+	if runtime == 0 {
+		progressbar = renderElapsedBar(currentTime)
+	}
+	if message, visible := drawStatusMessage(); visible {
+		menubar = message
+	}
+	if SEEK_PROMPT {
+		menubar = drawSeekPrompt()
+	}
+	if BOOKMARK_PROMPT {
+		menubar = drawBookmarkPrompt()
+	}
 
-	fmt.Print(gotoPos + menubar + gotoCharacter(0, TERMINAL_HEIGHT) + progressbar + "\033[0;0H")
+	return gotoPos + menubar + gotoCharacter(0, TERMINAL_HEIGHT) + progressbar
+}
+
+// Replaces the progressbar when the duration is unknown
+func renderElapsedBar(currentTime int) string {
+	text := fmt.Sprintf(" elapsed %d:%02d ", currentTime/60, currentTime%60)
+	var indicator string
+	if CURRENT_VIDEO.live {
+		indicator = RED_COLOR + " ● LIVE" + CYAN_COLOR
+	}
+	if CURRENT_VIDEO.stream != nil {
+		first, last := streamWindow(&CURRENT_VIDEO)
+		firstTime := int(float64(first) / CURRENT_VIDEO.fps)
+		lastTime := int(float64(last) / CURRENT_VIDEO.fps)
+		text += fmt.Sprintf(" seekable %d:%02d-%d:%02d ", firstTime/60, firstTime%60, lastTime/60, lastTime%60)
+	}
+	// the indicator is 7 characters wide
+	textWidth := len(text)
+	if indicator != "" {
+		textWidth += 7
+	}
+	fill := max(TERMINAL_WIDTH-2-textWidth, 0)
+	if textWidth > TERMINAL_WIDTH-2 {
+		indicator = ""
+		text = text[:max(TERMINAL_WIDTH-2, 0)]
+	}
+	return BLUE_COLOR + "[" + CYAN_COLOR + indicator + text + BLUE_COLOR + strings.Repeat("─", fill) + "]" + RESET_COLOR
+}
+
+// Starts reading keyboard and mouse input, only when running in a terminal
+func startInput() {
+	if !INTERACTIVE || INPUT == nil {
+		return
+	}
+	// report mouse movement in SGR format, used for scrubbing on the progress bar
+	fmt.Print("\033[?1003h\033[?1006h")
+	go handleInput()
+}
+
+func waitForNextFrame(startFrameTime time.Time) {
+	if FAST {
+		return
+	}
+	var deltaTime time.Duration = time.Now().Sub(startFrameTime)
+	var frameTime time.Duration = time.Duration(float64(time.Second/time.Duration(CURRENT_VIDEO.fps)) / PLAYBACK.Speed())
+	time.Sleep(frameTime - deltaTime)
 }
 
 func handleInput() {
 	for {
-		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+		oldState, err := term.MakeRaw(int(INPUT.Fd()))
 		if err != nil {
 			fmt.Println(err)
+			EXIT_CODE = 1
 			exit()
 			return
 		}
-		defer term.Restore(int(os.Stdin.Fd()), oldState)
+		if TERMINAL_STATE == nil {
+			TERMINAL_STATE = oldState
+		}
+		defer term.Restore(int(INPUT.Fd()), oldState)
 
-		b := make([]byte, 1)
-		r, err := os.Stdin.Read(b)
+		b := make([]byte, 64)
+		r, err := INPUT.Read(b)
 
 		if err != nil || r == 0 {
 			continue
 		}
 
-		if b[0] == 32 || b[0] == 107 { // PAUSING: SPACEBAR, k
-			PAUSED = !PAUSED
-		}
-		if b[0] >= 48 && b[0] <= 58 { // GOTO: 0-9
-			GOTO = true
-			GOTOPOS = int(b[0]) - 48
-		}
-		if b[0] == 106 || b[0] == 60 { // SKIP BACK: j, <
-			SKIP_BACKWARD = true
-		}
-		if b[0] == 108 || b[0] == 62 { // SKIP FORWARD: l, >
-			SKIP_FORWARD = true
+		if r > 1 && b[0] == 27 { // ESCAPE SEQUENCE: mouse, arrow keys
+			handleEscapeSequence(b[:r])
+			continue
 		}
-		if b[0] == 3 || b[0] == 113 { // EXIT: ctrl-c, q
-			exit()
-			return
+		for _, key := range b[:r] {
+			handleKey(key)
 		}
 	}
 }
 
-func handleSkip() {
-	if SKIP_FORWARD {
-		stepForward(&CURRENT_VIDEO)
-		frame, _ := getFrame(&CURRENT_VIDEO)
-		previewFrame := processFrame(frame, CURRENT_VIDEO.width, CURRENT_VIDEO.height, CHANNELS)
-		printFrame(previewFrame)
-		SKIP_FORWARD = false
-	}
-	if SKIP_BACKWARD {
-		stepBackward(&CURRENT_VIDEO)
-		frame, _ := getFrame(&CURRENT_VIDEO)
-		previewFrame := processFrame(frame, CURRENT_VIDEO.width, CURRENT_VIDEO.height, CHANNELS)
-		printFrame(previewFrame)
-		SKIP_BACKWARD = false
+func handleKey(key byte) {
+	if key == 3 { // EXIT: ctrl-c
+		exit()
+		return
 	}
-}
-func handleGoto() {
-	if !GOTO {
+	if SEEK_PROMPT {
+		handlePromptInput(key)
 		return
 	}
-	targetFrame := (CURRENT_VIDEO.totalFrames / 10) * GOTOPOS
+	if BOOKMARK_PROMPT {
+		handleBookmarkPromptInput(key)
+		return
+	}
+	// digits are fixed, the other keys come from the config
+	if key >= 48 && key <= 57 { // GOTO: 0-9
+		first, last := seekRange(&CURRENT_VIDEO)
+		seekTo(first + ((last-first)/10)*(int(key)-48))
+	}
+	switch KEYBINDINGS[key] {
+	case "snapshot":
+		SNAPSHOT = true
+	case "reverse":
+		toggleReverse()
+	case "seek":
+		openSeekPrompt()
+	case "pause":
+		togglePause()
+	case "back":
+		showPreview(currentFrame()-SKIP_AMOUNT_S*int(CURRENT_VIDEO.fps), THUMBNAIL_PREVIEW_DURATION)
+		SKIPPED = -1
+		skip(-1)
+	case "forward":
+		showPreview(currentFrame()+SKIP_AMOUNT_S*int(CURRENT_VIDEO.fps), THUMBNAIL_PREVIEW_DURATION)
+		SKIPPED = 1
+		skip(1)
+	case "bookmark":
+		addBookmark()
+	case "next_bookmark":
+		jumpToBookmark(1)
+	case "previous_bookmark":
+		jumpToBookmark(-1)
+	case "quit":
+		exit()
+	}
+}
+
+var MOUSE_EVENT_REGEX = regexp.MustCompile(`\x1b\[<(\d+);(\d+);(\d+)([Mm])`)
+
+func handleEscapeSequence(sequence []byte) {
+	for _, matches := range MOUSE_EVENT_REGEX.FindAllSubmatch(sequence, -1) {
+		button, _ := strconv.Atoi(string(matches[1]))
+		x, _ := strconv.Atoi(string(matches[2]))
+		y, _ := strconv.Atoi(string(matches[3]))
+		handleMouse(button, x, y, string(matches[4]) == "m")
+	}
+}
 
-	setFrame(&CURRENT_VIDEO, targetFrame)
-	frame, _ := getFrame(&CURRENT_VIDEO)
-	previewFrame := processFrame(frame, CURRENT_VIDEO.width, CURRENT_VIDEO.height, CHANNELS)
-	printFrame(previewFrame)
-	GOTO = false
+// Hovering or dragging on the progress bar shows a thumbnail, clicking seeks
+func handleMouse(button int, x int, y int, released bool) {
+	// without a known duration there is no progress bar
+	if CURRENT_VIDEO.duration == 0 {
+		return
+	}
+	if y != TERMINAL_HEIGHT || x < 2 || x > TERMINAL_WIDTH-1 {
+		if PREVIEW_UNTIL.IsZero() {
+			hidePreview()
+		}
+		return
+	}
+	var progress float64 = float64(x-2) / float64(TERMINAL_WIDTH-3)
+	targetFrame := int(progress * float64(CURRENT_VIDEO.totalFrames))
+	showPreview(targetFrame, 0)
 
+	// left button released
+	if released && button&3 == 0 {
+		seekTo(PREVIEW_FRAME)
+	}
 }
+
 func exit() {
-	// clear screen before exiting
-	fmt.Printf("\033[0;0H")
-	for i := 0; i < TERMINAL_HEIGHT; i++ {
-		fmt.Println("\n")
+	if HOOK_STARTED {
+		if !PLAYING || watchedToEnd(&CURRENT_VIDEO) {
+			runHook("end")
+		}
+		runHook("quit")
+	}
+	emitIpcEvent(IpcEvent{Event: "end-file"})
+	stopIpcServer()
+	stopSync()
+	if INTERACTIVE {
+		// disable mouse reporting and clear screen before exiting
+		fmt.Print("\033[?1003l\033[?1006l")
+		fmt.Printf("\033[0;0H")
+		for i := 0; i < TERMINAL_HEIGHT; i++ {
+			fmt.Print("\n\n")
+		}
 	}
 	fmt.Println(RESET_COLOR)
-	os.Exit(1)
+	if TERMINAL_STATE != nil {
+		term.Restore(int(INPUT.Fd()), TERMINAL_STATE)
+	}
+	if err := playbackError(); err != nil {
+		printError("Playback stopped:", err)
+	}
+	savePosition(&CURRENT_VIDEO)
+	recordHistory(&CURRENT_VIDEO)
+	waitForHooks()
+	os.Exit(EXIT_CODE)
+}
+
+// Stops playback, the play loop exits with the error
+func failPlayback(err error) {
+	PLAYBACK_ERROR_MUTEX.Lock()
+	defer PLAYBACK_ERROR_MUTEX.Unlock()
+	if PLAYBACK_ERROR == nil {
+		PLAYBACK_ERROR = err
+	}
+}
+
+func playbackError() error {
+	PLAYBACK_ERROR_MUTEX.Lock()
+	defer PLAYBACK_ERROR_MUTEX.Unlock()
+	return PLAYBACK_ERROR
 }
 
 func setTerminalDimensions() bool {
+	if FIXED_SIZE {
+		return false
+	}
 	fd := int(os.Stdout.Fd())
 	width, height, err := term.GetSize(int(fd))
 	if err != nil {
 		fmt.Println(PREFIX, "Error getting terminal dimensions:", err)
+		EXIT_CODE = 1
 		exit()
 	}
 	widthChanged := width != TERMINAL_WIDTH
@@ -281,3 +863,17 @@ func setTerminalDimensions() bool {
 	TERMINAL_HEIGHT = height
 	return widthChanged || heightChanged
 }
+
+// Parses a size like 80x24
+func parseSize(size string) (int, int, error) {
+	colsText, rowsText, found := strings.Cut(strings.ToLower(size), "x")
+	cols, colsErr := strconv.Atoi(colsText)
+	rows, rowsErr := strconv.Atoi(rowsText)
+	if !found || colsErr != nil || rowsErr != nil {
+		return 0, 0, fmt.Errorf("'%s' is not a size like 80x24", size)
+	}
+	if cols < 1 || rows < 4 {
+		return 0, 0, fmt.Errorf("'%s' is too small, the minimum is 1x4", size)
+	}
+	return cols, rows, nil
+}
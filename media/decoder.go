@@ -0,0 +1,433 @@
+package media
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Frames are decoded as gray pixels, one byte each
+const CHANNELS = 1
+
+type Frame []byte
+
+// A backend that decodes the played stream of a video into gray frames.
+// Frames are read in order, a Decoder can't be used from several goroutines at once.
+type Decoder interface {
+	// Describes the video, frames have the size and rate of its played stream
+	Probe() (MediaInfo, error)
+	// The next ReadFrame returns the first frame at or after the position
+	Seek(position time.Duration) error
+	// Returns the next frame and its timestamp, io.EOF after the last frame
+	ReadFrame() (Frame, time.Duration, error)
+	Close() error
+}
+
+// Decoders that can wait a long time in ReadFrame, like ones reconnecting to a network input.
+// Interrupt can be called while another goroutine reads, the waiting ReadFrame then fails with ErrInterrupted.
+type Interrupter interface {
+	Interrupt()
+}
+
+var ErrInterrupted = errors.New("reading was interrupted")
+
+func frameTime(frame int, fps float64) time.Duration {
+	return time.Duration(float64(frame) / fps * float64(time.Second))
+}
+
+func frameAt(position time.Duration, fps float64) int {
+	return int(math.Round(position.Seconds() * fps))
+}
+
+// Reads frameAmount frames from startFrame, calling onFrame for every frame until it returns false.
+// Reading stops early without an error at the end of the video.
+func ReadFrames(decoder Decoder, fps float64, startFrame int, frameAmount int, onFrame func(Frame) bool) error {
+	if err := decoder.Seek(frameTime(startFrame, fps)); err != nil {
+		return err
+	}
+	for i := 0; i < frameAmount; i++ {
+		frame, _, err := decoder.ReadFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !onFrame(frame) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Decodes files, urls and lavfi sources with an ffmpeg process. The process keeps running
+// between reads, so reading on after the last frame doesn't start a new one.
+// Close can be called while another goroutine waits in ReadFrame, which then fails.
+type FfmpegDecoder struct {
+	path      string
+	info      *MediaInfo
+	width     int
+	height    int
+	fps       float64
+	nextFrame int
+	// frames are scaled to this size when it is set
+	scaleWidth  int
+	scaleHeight int
+	// only keyframes are decoded, with the timestamps ffmpeg reports
+	keyframes  bool
+	timestamps chan time.Duration
+	// the input is read once by a process started when probing
+	pipe   bool
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	closed bool
+	mutex  sync.Mutex
+}
+
+func NewFfmpegDecoder(path string) *FfmpegDecoder {
+	return &FfmpegDecoder{path: path}
+}
+
+// Decodes only the keyframes, scaled to width x height, for previews of the whole video
+func NewKeyframeDecoder(path string, width int, height int) *FfmpegDecoder {
+	return &FfmpegDecoder{path: path, keyframes: true, scaleWidth: width, scaleHeight: height}
+}
+
+// Decodes inputs that can only be read once, like pipes, stdin ("-") and live streams.
+// The video is described by what ffmpeg prints about the input, since ffprobe would read it too,
+// and it can't be seeked. Frames are scaled to width x height when they are set.
+func NewPipeDecoder(path string, width int, height int) *FfmpegDecoder {
+	return &FfmpegDecoder{path: path, pipe: true, scaleWidth: width, scaleHeight: height}
+}
+
+// Probes once, later calls return the same information
+func (decoder *FfmpegDecoder) Probe() (MediaInfo, error) {
+	decoder.mutex.Lock()
+	defer decoder.mutex.Unlock()
+	return decoder.probe()
+}
+
+func (decoder *FfmpegDecoder) probe() (MediaInfo, error) {
+	if decoder.info != nil {
+		return *decoder.info, nil
+	}
+	if decoder.closed {
+		return MediaInfo{}, errors.New("the decoder is closed")
+	}
+	var info MediaInfo
+	var err error
+	if decoder.pipe {
+		info, err = decoder.probePipe()
+	} else {
+		info, err = Probe(decoder.path)
+	}
+	if err != nil {
+		return MediaInfo{}, err
+	}
+	stream := PlayedStream(&info)
+	if stream == nil {
+		decoder.stop()
+		return MediaInfo{}, errors.New("there is no video stream")
+	}
+	if decoder.scaleWidth > 0 && decoder.scaleHeight > 0 {
+		stream.Width, stream.Height = decoder.scaleWidth, decoder.scaleHeight
+	}
+	decoder.info = &info
+	decoder.width = stream.Width
+	decoder.height = stream.Height
+	decoder.fps = stream.FrameRate.Float()
+	return info, nil
+}
+
+// Starts decoding and reads the description ffmpeg prints before the first frame
+func (decoder *FfmpegDecoder) probePipe() (MediaInfo, error) {
+	stderr, err := decoder.start()
+	if err != nil {
+		return MediaInfo{}, err
+	}
+	// the header is complete once the output is described
+	var header strings.Builder
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		header.WriteString(scanner.Text() + "\n")
+		if strings.HasPrefix(scanner.Text(), "Output #0") {
+			break
+		}
+	}
+	// keep reading so ffmpeg never blocks on a full stderr pipe
+	go io.Copy(io.Discard, stderr)
+
+	info, ok := ParseFfmpegHeader(decoder.path, header.String())
+	if !ok {
+		decoder.stop()
+		return MediaInfo{}, errors.New("'" + decoder.path + "' is not a video")
+	}
+	return info, nil
+}
+
+func (decoder *FfmpegDecoder) Seek(position time.Duration) error {
+	decoder.mutex.Lock()
+	defer decoder.mutex.Unlock()
+	if decoder.closed {
+		return errors.New("the decoder is closed")
+	}
+	if _, err := decoder.probe(); err != nil {
+		return err
+	}
+	frame := max(frameAt(position, decoder.fps), 0)
+	if decoder.cmd != nil && frame == decoder.nextFrame {
+		return nil
+	}
+	if decoder.pipe {
+		return errors.New("a pipe can't be seeked")
+	}
+	decoder.stop()
+	decoder.nextFrame = frame
+	return nil
+}
+
+func (decoder *FfmpegDecoder) ReadFrame() (Frame, time.Duration, error) {
+	decoder.mutex.Lock()
+	if decoder.closed {
+		decoder.mutex.Unlock()
+		return nil, 0, errors.New("the decoder is closed")
+	}
+	if _, err := decoder.probe(); err != nil {
+		decoder.mutex.Unlock()
+		return nil, 0, err
+	}
+	if decoder.cmd == nil {
+		// a pipe was read to the end
+		if decoder.pipe {
+			decoder.mutex.Unlock()
+			return nil, 0, io.EOF
+		}
+		if _, err := decoder.start(); err != nil {
+			decoder.mutex.Unlock()
+			return nil, 0, err
+		}
+	}
+	stdout, timestamps := decoder.stdout, decoder.timestamps
+	decoder.mutex.Unlock()
+
+	// read without holding the lock, so Close can end a read that waits for input
+	frame := make(Frame, decoder.width*decoder.height*CHANNELS)
+	_, err := io.ReadFull(stdout, frame)
+	timestamp := frameTime(decoder.nextFrame, decoder.fps)
+	if err == nil && timestamps != nil {
+		var ok bool
+		if timestamp, ok = <-timestamps; !ok {
+			err = io.EOF
+		}
+	}
+
+	decoder.mutex.Lock()
+	defer decoder.mutex.Unlock()
+	if decoder.closed {
+		return nil, 0, errors.New("the decoder is closed")
+	}
+	if err == io.EOF {
+		// ffmpeg finished, it failed when it exits with an error
+		if err := decoder.wait(); err != nil {
+			return nil, 0, fmt.Errorf("FFmpeg command failed: %v", err)
+		}
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		decoder.stop()
+		return nil, 0, fmt.Errorf("Failed during FFmpeg execution: %v", err)
+	}
+	decoder.nextFrame++
+	return frame, timestamp, nil
+}
+
+func (decoder *FfmpegDecoder) Close() error {
+	decoder.mutex.Lock()
+	defer decoder.mutex.Unlock()
+	decoder.closed = true
+	decoder.stop()
+	return nil
+}
+
+// Decodes from nextFrame to the end of the video. Returns stderr for pipes, whose header is read from it.
+func (decoder *FfmpegDecoder) start() (io.Reader, error) {
+	filter := "format=gray"
+	if decoder.scaleWidth > 0 && decoder.scaleHeight > 0 {
+		filter = fmt.Sprintf("scale=%d:%d,", decoder.scaleWidth, decoder.scaleHeight) + filter
+	}
+	var args []string
+	switch {
+	case decoder.pipe:
+		input := decoder.path
+		if input == "-" {
+			input = "pipe:0"
+		}
+		args = append(NetworkArgs(decoder.path), "-hide_banner", "-nostats", "-i", input, "-an", "-vf", filter)
+	case decoder.keyframes:
+		args = append([]string{"-skip_frame", "nokey"}, InputArgs(decoder.path)...)
+		// the timestamps of the keyframes are read from the showinfo output
+		args = append(args, "-an", "-vf", filter+",showinfo", "-vsync", "vfr")
+	default:
+		args = []string{"-ss", fmt.Sprintf("%.6f", frameTime(decoder.nextFrame, decoder.fps).Seconds())}
+		args = append(args, InputArgs(decoder.path)...)
+		args = append(args, "-vf", fmt.Sprintf("fps=%.5f,", decoder.fps)+filter, "-vsync", "vfr")
+	}
+	args = append(args, "-f", "image2pipe", "-vcodec", "rawvideo", "-pix_fmt", "gray", "-")
+
+	cmd := exec.Command("ffmpeg", args...)
+	if decoder.path == "-" {
+		cmd.Stdin = os.Stdin
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get stdout pipe: %v", err)
+	}
+	var stderr io.ReadCloser
+	if decoder.pipe || decoder.keyframes {
+		if stderr, err = cmd.StderrPipe(); err != nil {
+			return nil, fmt.Errorf("Failed to get stderr pipe: %v", err)
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to start FFmpeg command: %v", err)
+	}
+	decoder.cmd = cmd
+	decoder.stdout = stdout
+	if decoder.keyframes {
+		decoder.timestamps = make(chan time.Duration, 64)
+		go readShowinfoTimestamps(stderr, decoder.timestamps)
+	}
+	return stderr, nil
+}
+
+// Sends the timestamp of every frame the showinfo filter describes
+func readShowinfoTimestamps(stderr io.Reader, timestamps chan<- time.Duration) {
+	re := regexp.MustCompile(`pts_time:\s*([\d.]+)`)
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, "Parsed_showinfo") {
+			continue
+		}
+		if matches := re.FindStringSubmatch(line); len(matches) > 0 {
+			seconds, _ := strconv.ParseFloat(matches[1], 64)
+			timestamps <- time.Duration(seconds * float64(time.Second))
+		}
+	}
+	close(timestamps)
+}
+
+func (decoder *FfmpegDecoder) wait() error {
+	if decoder.cmd == nil {
+		return nil
+	}
+	// stderr has to be read to the end before waiting
+	if decoder.timestamps != nil {
+		for range decoder.timestamps {
+		}
+	}
+	err := decoder.cmd.Wait()
+	decoder.cmd = nil
+	decoder.stdout = nil
+	decoder.timestamps = nil
+	return err
+}
+
+// Ends the running process, its remaining frames aren't needed
+func (decoder *FfmpegDecoder) stop() {
+	if decoder.cmd == nil {
+		return
+	}
+	decoder.cmd.Process.Kill()
+	decoder.wait()
+}
+
+// Decodes frames kept in memory, the same calls always return the same frames.
+// Useful to run players without ffmpeg, for example in tests.
+type MemoryDecoder struct {
+	info      MediaInfo
+	frames    []Frame
+	fps       float64
+	nextFrame int
+	closed    bool
+}
+
+// Frames have to be width x height gray pixels
+func NewMemoryDecoder(path string, width int, height int, fps float64, frames []Frame) *MemoryDecoder {
+	duration := float64(len(frames)) / fps
+	return &MemoryDecoder{
+		info: MediaInfo{
+			Path:     path,
+			Format:   "memory",
+			Duration: duration,
+			Streams: []StreamInfo{{
+				Type:        "video",
+				Codec:       "rawvideo",
+				Width:       width,
+				Height:      height,
+				FrameRate:   RationalFromFloat(fps),
+				PixelFormat: "gray",
+				Duration:    duration,
+				Default:     true,
+			}},
+			Chapters: []ChapterInfo{},
+		},
+		frames: frames,
+		fps:    fps,
+	}
+}
+
+// Frames with a diagonal gradient that moves one step every frame
+func PatternFrames(width int, height int, amount int) []Frame {
+	frames := make([]Frame, amount)
+	for i := range frames {
+		frame := make(Frame, width*height*CHANNELS)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				frame[(y*width+x)*CHANNELS] = byte(x + y + i)
+			}
+		}
+		frames[i] = frame
+	}
+	return frames
+}
+
+func (decoder *MemoryDecoder) Probe() (MediaInfo, error) {
+	return decoder.info, nil
+}
+
+func (decoder *MemoryDecoder) Seek(position time.Duration) error {
+	if decoder.closed {
+		return errors.New("the decoder is closed")
+	}
+	decoder.nextFrame = min(max(frameAt(position, decoder.fps), 0), len(decoder.frames))
+	return nil
+}
+
+// Returns a copy, so changing the frame doesn't change later reads
+func (decoder *MemoryDecoder) ReadFrame() (Frame, time.Duration, error) {
+	if decoder.closed {
+		return nil, 0, errors.New("the decoder is closed")
+	}
+	if decoder.nextFrame >= len(decoder.frames) {
+		return nil, 0, io.EOF
+	}
+	frame := append(Frame{}, decoder.frames[decoder.nextFrame]...)
+	timestamp := frameTime(decoder.nextFrame, decoder.fps)
+	decoder.nextFrame++
+	return frame, timestamp, nil
+}
+
+func (decoder *MemoryDecoder) Close() error {
+	decoder.closed = true
+	return nil
+}
@@ -0,0 +1,311 @@
+package media
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+const TEST_WIDTH = 4
+const TEST_HEIGHT = 2
+const TEST_FPS float64 = 10
+
+func newTestDecoder(frames int) *MemoryDecoder {
+	return NewMemoryDecoder("memory", TEST_WIDTH, TEST_HEIGHT, TEST_FPS, PatternFrames(TEST_WIDTH, TEST_HEIGHT, frames))
+}
+
+func TestReadFrames(t *testing.T) {
+	tests := []struct {
+		name        string
+		startFrame  int
+		frameAmount int
+		stopAfter   int
+		want        []int
+	}{
+		{"from the start", 0, 3, -1, []int{0, 1, 2}},
+		{"from the middle", 4, 2, -1, []int{4, 5}},
+		{"past the end", 8, 5, -1, []int{8, 9}},
+		{"after the end", 12, 3, -1, nil},
+		{"nothing", 2, 0, -1, nil},
+		{"stopped early", 1, 5, 2, []int{1, 2}},
+		{"before the start", -3, 2, -1, []int{0, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoder := newTestDecoder(10)
+			expected := PatternFrames(TEST_WIDTH, TEST_HEIGHT, 10)
+			var got []Frame
+			err := ReadFrames(decoder, TEST_FPS, test.startFrame, test.frameAmount, func(frame Frame) bool {
+				got = append(got, frame)
+				return len(got) != test.stopAfter
+			})
+			if err != nil {
+				t.Fatalf("ReadFrames: %v", err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("read %d frames, want %d", len(got), len(test.want))
+			}
+			for i, frameNumber := range test.want {
+				if !bytes.Equal(got[i], expected[frameNumber]) {
+					t.Errorf("frame %d is not frame %d of the video", i, frameNumber)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryDecoderSeek(t *testing.T) {
+	tests := []struct {
+		position  time.Duration
+		wantFrame int
+		wantEOF   bool
+	}{
+		{0, 0, false},
+		{500 * time.Millisecond, 5, false},
+		// positions are rounded to the closest frame
+		{540 * time.Millisecond, 5, false},
+		{560 * time.Millisecond, 6, false},
+		{-time.Second, 0, false},
+		{900 * time.Millisecond, 9, false},
+		{time.Second, 0, true},
+		{time.Hour, 0, true},
+	}
+	decoder := newTestDecoder(10)
+	expected := PatternFrames(TEST_WIDTH, TEST_HEIGHT, 10)
+	for _, test := range tests {
+		if err := decoder.Seek(test.position); err != nil {
+			t.Fatalf("Seek(%v): %v", test.position, err)
+		}
+		frame, timestamp, err := decoder.ReadFrame()
+		if test.wantEOF {
+			if err != io.EOF {
+				t.Errorf("Seek(%v) then ReadFrame: error %v, want io.EOF", test.position, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Seek(%v) then ReadFrame: %v", test.position, err)
+		}
+		if !bytes.Equal(frame, expected[test.wantFrame]) {
+			t.Errorf("Seek(%v) read another frame than frame %d", test.position, test.wantFrame)
+		}
+		if want := frameTime(test.wantFrame, TEST_FPS); timestamp != want {
+			t.Errorf("Seek(%v) timestamp = %v, want %v", test.position, timestamp, want)
+		}
+	}
+}
+
+func TestMemoryDecoderReadsCopies(t *testing.T) {
+	decoder := newTestDecoder(2)
+	frame, _, _ := decoder.ReadFrame()
+	frame[0]++
+	decoder.Seek(0)
+	again, _, _ := decoder.ReadFrame()
+	if bytes.Equal(frame, again) {
+		t.Error("changing a read frame changed the frames of the decoder")
+	}
+}
+
+func TestMemoryDecoderClosed(t *testing.T) {
+	decoder := newTestDecoder(2)
+	decoder.Close()
+	if err := decoder.Seek(0); err == nil {
+		t.Error("Seek on a closed decoder succeeded")
+	}
+	if _, _, err := decoder.ReadFrame(); err == nil || err == io.EOF {
+		t.Errorf("ReadFrame on a closed decoder: error %v, want a failure", err)
+	}
+}
+
+func requireFfmpeg(t *testing.T) {
+	t.Helper()
+	for _, command := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(command); err != nil {
+			t.Skip(command + " is not installed")
+		}
+	}
+}
+
+func TestFfmpegDecoderSeek(t *testing.T) {
+	requireFfmpeg(t)
+	decoder := NewFfmpegDecoder("lavfi:testsrc2=size=64x48:rate=10:duration=3")
+	defer decoder.Close()
+	info, err := decoder.Probe()
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	stream := PlayedStream(&info)
+	if stream == nil || stream.Width != 64 || stream.Height != 48 || stream.FrameRate.Float() != 10 {
+		t.Fatalf("Probe found %+v, want 64x48 at 10 fps", stream)
+	}
+
+	var frames []Frame
+	if err := ReadFrames(decoder, 10, 0, 30, func(frame Frame) bool {
+		frames = append(frames, frame)
+		return true
+	}); err != nil {
+		t.Fatalf("ReadFrames: %v", err)
+	}
+	if len(frames) != 30 {
+		t.Fatalf("read %d frames, want 30", len(frames))
+	}
+	if _, _, err := decoder.ReadFrame(); err != io.EOF {
+		t.Fatalf("ReadFrame after the last frame: error %v, want io.EOF", err)
+	}
+
+	// seeking restarts ffmpeg at the exact frame
+	decoder.Seek(frameTime(12, 10))
+	frame, timestamp, err := decoder.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame after seeking: %v", err)
+	}
+	if !bytes.Equal(frame, frames[12]) || timestamp != frameTime(12, 10) {
+		t.Errorf("seeking to frame 12 read frame at %v, or another frame", timestamp)
+	}
+
+	// reading on from where the last read stopped keeps the process running
+	cmd := decoder.cmd
+	decoder.Seek(frameTime(13, 10))
+	frame, _, err = decoder.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame after continuing: %v", err)
+	}
+	if decoder.cmd != cmd {
+		t.Error("continuing at the next frame restarted ffmpeg")
+	}
+	if !bytes.Equal(frame, frames[13]) {
+		t.Error("continuing at frame 13 read another frame")
+	}
+
+	// going back restarts it
+	decoder.Seek(frameTime(2, 10))
+	frame, _, err = decoder.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame after seeking back: %v", err)
+	}
+	if decoder.cmd == cmd {
+		t.Error("seeking back didn't restart ffmpeg")
+	}
+	if !bytes.Equal(frame, frames[2]) {
+		t.Error("seeking back to frame 2 read another frame")
+	}
+}
+
+func TestParseFfmpegHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		width    int
+		height   int
+		fps      float64
+		duration float64
+		ok       bool
+	}{
+		{
+			"file",
+			"Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'video.mp4':\n  Duration: 00:01:02.50, start: 0.000000, bitrate: 500 kb/s\n" +
+				"  Stream #0:0(und): Video: h264 (High) (avc1 / 0x31637661), yuv420p(progressive), 1280x720 [SAR 1:1 DAR 16:9], 400 kb/s, 29.97 fps, 29.97 tbr\nOutput #0, image2pipe, to 'pipe:':\n",
+			1280, 720, 29.97, 62.5, true,
+		},
+		{
+			"pipe without a duration",
+			"Input #0, mpegts, from 'pipe:0':\n  Duration: N/A, start: 1.400000, bitrate: N/A\n  Stream #0:0[0x100]: Video: h264 (Main), yuv420p, 640x360, 25 fps, 25 tbr\nOutput #0, image2pipe, to 'pipe:':\n",
+			640, 360, 25, 0, true,
+		},
+		{"audio only", "Input #0, mp3, from 'song.mp3':\n  Duration: 00:03:00.00\n  Stream #0:0: Audio: mp3, 44100 Hz, stereo\n", 0, 0, 0, 0, false},
+		{"no frame rate", "  Stream #0:0: Video: h264, yuv420p, 640x360\n", 0, 0, 0, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, ok := ParseFfmpegHeader("input", test.header)
+			if ok != test.ok {
+				t.Fatalf("ParseFfmpegHeader returned %v, want %v", ok, test.ok)
+			}
+			if !ok {
+				return
+			}
+			stream := PlayedStream(&info)
+			if stream == nil || stream.Width != test.width || stream.Height != test.height || stream.FrameRate.Float() != test.fps {
+				t.Errorf("found %+v, want %dx%d at %v fps", stream, test.width, test.height, test.fps)
+			}
+			if info.Duration != test.duration {
+				t.Errorf("duration is %v, want %v", info.Duration, test.duration)
+			}
+		})
+	}
+}
+
+func TestKeyframeDecoder(t *testing.T) {
+	requireFfmpeg(t)
+	// a keyframe every 10 frames
+	decoder := NewKeyframeDecoder("lavfi:testsrc2=size=64x48:rate=10:duration=3,format=yuv420p", 16, 12)
+	defer decoder.Close()
+	info, err := decoder.Probe()
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	if stream := PlayedStream(&info); stream.Width != 16 || stream.Height != 12 {
+		t.Errorf("Probe found %dx%d, want the scaled size 16x12", stream.Width, stream.Height)
+	}
+	var timestamps []time.Duration
+	for {
+		frame, timestamp, err := decoder.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if len(frame) != 16*12*CHANNELS {
+			t.Fatalf("frame has %d bytes, want %d", len(frame), 16*12*CHANNELS)
+		}
+		timestamps = append(timestamps, timestamp)
+	}
+	if len(timestamps) == 0 || timestamps[0] != 0 {
+		t.Fatalf("read keyframes at %v, want the first one at 0", timestamps)
+	}
+	for i := 1; i < len(timestamps); i++ {
+		if timestamps[i] <= timestamps[i-1] {
+			t.Errorf("keyframe timestamps %v don't increase", timestamps)
+		}
+	}
+}
+
+func TestPipeDecoder(t *testing.T) {
+	requireFfmpeg(t)
+	path := t.TempDir() + "/video.ts"
+	if output, err := exec.Command("ffmpeg", "-loglevel", "error", "-f", "lavfi", "-i", "testsrc2=size=64x48:rate=10:duration=2", "-c:v", "mpeg2video", path).CombinedOutput(); err != nil {
+		t.Fatalf("encoding: %v\n%s", err, output)
+	}
+	decoder := NewPipeDecoder(path, 32, 24)
+	defer decoder.Close()
+	info, err := decoder.Probe()
+	if err != nil {
+		t.Fatalf("Probe: %v", err)
+	}
+	if stream := PlayedStream(&info); stream.Width != 32 || stream.Height != 24 || stream.FrameRate.Float() != 10 {
+		t.Errorf("Probe found %+v, want 32x24 at 10 fps", stream)
+	}
+	frames := 0
+	for {
+		frame, _, err := decoder.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if len(frame) != 32*24*CHANNELS {
+			t.Fatalf("frame has %d bytes, want %d", len(frame), 32*24*CHANNELS)
+		}
+		frames++
+	}
+	if frames != 20 {
+		t.Errorf("read %d frames, want 20", frames)
+	}
+	if err := decoder.Seek(0); err == nil {
+		t.Error("seeking a pipe succeeded")
+	}
+}
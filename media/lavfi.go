@@ -0,0 +1,166 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const LAVFI_PREFIX = "lavfi:"
+const LAVFI_DEFAULT_RATE float64 = 25
+const LAVFI_DEFAULT_DURATION = time.Minute
+
+// Default sizes of ffmpeg's generated sources, most use 320x240
+var LAVFI_DEFAULT_SIZES = map[string][2]int{
+	"mandelbrot":  {640, 480},
+	"smptehdbars": {1280, 720},
+}
+
+// Size and rate abbreviations ffmpeg accepts
+var LAVFI_SIZE_NAMES = map[string][2]int{
+	"sqcif":  {128, 96},
+	"qcif":   {176, 144},
+	"cif":    {352, 288},
+	"qvga":   {320, 240},
+	"vga":    {640, 480},
+	"svga":   {800, 600},
+	"xga":    {1024, 768},
+	"ntsc":   {720, 480},
+	"pal":    {720, 576},
+	"hd480":  {852, 480},
+	"hd720":  {1280, 720},
+	"hd1080": {1920, 1080},
+}
+var LAVFI_RATE_NAMES = map[string]float64{
+	"ntsc":      30000.0 / 1001,
+	"pal":       25,
+	"film":      24,
+	"ntsc-film": 24000.0 / 1001,
+}
+
+// A generated source like 'lavfi:testsrc2=size=640x480:rate=30:duration=10'.
+// The video information comes from the options of the first filter in the graph.
+type LavfiSource struct {
+	graph    string
+	width    int
+	height   int
+	fps      float64
+	duration time.Duration
+}
+
+func IsLavfi(path string) bool {
+	return strings.HasPrefix(path, LAVFI_PREFIX)
+}
+
+func ParseLavfiSource(path string) (LavfiSource, error) {
+	graph := strings.TrimPrefix(path, LAVFI_PREFIX)
+	if graph == "" {
+		return LavfiSource{}, errors.New("empty filter graph")
+	}
+	// only the source at the start of the graph is inspected
+	sourceEnd := strings.IndexAny(graph, ",;[")
+	if sourceEnd < 0 {
+		sourceEnd = len(graph)
+	}
+	source := graph[:sourceEnd]
+	name, options, _ := strings.Cut(source, "=")
+
+	lavfi := LavfiSource{width: 320, height: 240, fps: LAVFI_DEFAULT_RATE}
+	if size, exists := LAVFI_DEFAULT_SIZES[name]; exists {
+		lavfi.width, lavfi.height = size[0], size[1]
+	}
+	hasDuration := false
+
+	for _, option := range strings.Split(options, ":") {
+		if option == "" {
+			continue
+		}
+		key, value, found := strings.Cut(option, "=")
+		if !found {
+			continue
+		}
+		var err error
+		switch key {
+		case "size", "s":
+			lavfi.width, lavfi.height, err = parseLavfiSize(value)
+		case "rate", "r":
+			lavfi.fps, err = parseLavfiRate(value)
+		case "duration", "d":
+			var seconds float64
+			seconds, err = parseLavfiDuration(value)
+			lavfi.duration = time.Duration(seconds * float64(time.Second))
+			hasDuration = true
+		}
+		if err != nil {
+			return LavfiSource{}, fmt.Errorf("invalid %s option: %v", key, err)
+		}
+	}
+
+	// generated sources are endless unless they are given a duration
+	if !hasDuration || lavfi.duration <= 0 {
+		lavfi.duration = LAVFI_DEFAULT_DURATION
+		separator := ":"
+		if options == "" {
+			separator = "="
+		}
+		source += fmt.Sprintf("%sduration=%g", separator, LAVFI_DEFAULT_DURATION.Seconds())
+	}
+	// later filters could change the size, so it's forced back to the known size
+	lavfi.graph = source + graph[sourceEnd:]
+	if sourceEnd < len(graph) {
+		lavfi.graph += fmt.Sprintf(",scale=%d:%d", lavfi.width, lavfi.height)
+	}
+	return lavfi, nil
+}
+
+func parseLavfiSize(value string) (int, int, error) {
+	if size, exists := LAVFI_SIZE_NAMES[value]; exists {
+		return size[0], size[1], nil
+	}
+	widthText, heightText, _ := strings.Cut(value, "x")
+	width, widthErr := strconv.Atoi(widthText)
+	height, heightErr := strconv.Atoi(heightText)
+	if widthErr != nil || heightErr != nil || width < 1 || height < 1 {
+		return 0, 0, fmt.Errorf("'%s' is not a size like 320x240", value)
+	}
+	return width, height, nil
+}
+
+func parseLavfiRate(value string) (float64, error) {
+	if rate, exists := LAVFI_RATE_NAMES[value]; exists {
+		return rate, nil
+	}
+	numeratorText, denominatorText, isFraction := strings.Cut(value, "/")
+	numerator, err := strconv.ParseFloat(numeratorText, 64)
+	denominator := 1.0
+	if err == nil && isFraction {
+		denominator, err = strconv.ParseFloat(denominatorText, 64)
+	}
+	if err != nil || numerator <= 0 || denominator <= 0 {
+		return 0, fmt.Errorf("'%s' is not a frame rate", value)
+	}
+	return numerator / denominator, nil
+}
+
+// Durations are either seconds or [HH:]MM:SS[.m]
+func parseLavfiDuration(value string) (float64, error) {
+	if strings.Contains(value, ":") {
+		return ParseTimestamp(value)
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSuffix(value, "s"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a duration", value)
+	}
+	return seconds, nil
+}
+
+// ffmpeg input arguments for a path, which can be a file, url or generated source
+func InputArgs(path string) []string {
+	if IsLavfi(path) {
+		lavfi, _ := ParseLavfiSource(path)
+		return []string{"-f", "lavfi", "-i", lavfi.graph}
+	}
+	return append(NetworkArgs(path), "-i", path)
+}
@@ -0,0 +1,88 @@
+package media
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLavfiSource(t *testing.T) {
+	tests := []struct {
+		path     string
+		graph    string
+		width    int
+		height   int
+		fps      float64
+		duration time.Duration
+		wantErr  bool
+	}{
+		{
+			path:  "lavfi:testsrc2",
+			graph: "testsrc2=duration=60", width: 320, height: 240, fps: 25, duration: time.Minute,
+		},
+		{
+			path:  "lavfi:mandelbrot",
+			graph: "mandelbrot=duration=60", width: 640, height: 480, fps: 25, duration: time.Minute,
+		},
+		{
+			path:  "lavfi:testsrc2=size=640x480:rate=30:duration=10",
+			graph: "testsrc2=size=640x480:rate=30:duration=10", width: 640, height: 480, fps: 30, duration: 10 * time.Second,
+		},
+		{
+			path:  "lavfi:testsrc=s=hd720:r=ntsc:d=90",
+			graph: "testsrc=s=hd720:r=ntsc:d=90", width: 1280, height: 720, fps: 30000.0 / 1001, duration: 90 * time.Second,
+		},
+		{
+			path:  "lavfi:smptebars=rate=30000/1001",
+			graph: "smptebars=rate=30000/1001:duration=60", width: 320, height: 240, fps: 30000.0 / 1001, duration: time.Minute,
+		},
+		{
+			path:  "lavfi:testsrc=size=vga,hflip",
+			graph: "testsrc=size=vga:duration=60,hflip,scale=640:480", width: 640, height: 480, fps: 25, duration: time.Minute,
+		},
+		{
+			path:  "lavfi:color=c=red:d=0",
+			graph: "color=c=red:d=0:duration=60", width: 320, height: 240, fps: 25, duration: time.Minute,
+		},
+		{path: "lavfi:", wantErr: true},
+		{path: "lavfi:testsrc=size=big", wantErr: true},
+		{path: "lavfi:testsrc=size=0x240", wantErr: true},
+		{path: "lavfi:testsrc=rate=0", wantErr: true},
+		{path: "lavfi:testsrc=rate=30/0", wantErr: true},
+		{path: "lavfi:testsrc=duration=soon", wantErr: true},
+	}
+	for _, test := range tests {
+		lavfi, err := ParseLavfiSource(test.path)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseLavfiSource(%q) error = %v, want error %v", test.path, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		if lavfi.graph != test.graph {
+			t.Errorf("ParseLavfiSource(%q) graph = %q, want %q", test.path, lavfi.graph, test.graph)
+		}
+		if lavfi.width != test.width || lavfi.height != test.height {
+			t.Errorf("ParseLavfiSource(%q) size = %dx%d, want %dx%d", test.path, lavfi.width, lavfi.height, test.width, test.height)
+		}
+		if lavfi.fps != test.fps {
+			t.Errorf("ParseLavfiSource(%q) fps = %g, want %g", test.path, lavfi.fps, test.fps)
+		}
+		if lavfi.duration != test.duration {
+			t.Errorf("ParseLavfiSource(%q) duration = %v, want %v", test.path, lavfi.duration, test.duration)
+		}
+	}
+}
+
+func TestInputArgs(t *testing.T) {
+	args := InputArgs("lavfi:testsrc2=duration=5")
+	want := []string{"-f", "lavfi", "-i", "testsrc2=duration=5"}
+	if len(args) != len(want) {
+		t.Fatalf("InputArgs = %q, want %q", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("InputArgs = %q, want %q", args, want)
+		}
+	}
+}
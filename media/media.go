@@ -0,0 +1,315 @@
+// Package media probes and decodes videos, files, urls and generated lavfi sources, with ffmpeg.
+package media
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// What a file contains, as reported by ffprobe. Players build what they play from this,
+// so 'play info' always shows what is played.
+type MediaInfo struct {
+	Path       string            `json:"path"`
+	Format     string            `json:"format"`
+	FormatName string            `json:"format_name,omitempty"`
+	Duration   float64           `json:"duration"`
+	Size       int64             `json:"size,omitempty"`
+	BitRate    int64             `json:"bit_rate,omitempty"`
+	Streams    []StreamInfo      `json:"streams"`
+	Chapters   []ChapterInfo     `json:"chapters"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// Video streams have a resolution, frame rate and pixel format, audio streams channels and a sample rate
+type StreamInfo struct {
+	Index         int               `json:"index"`
+	Type          string            `json:"type"`
+	Codec         string            `json:"codec"`
+	Profile       string            `json:"profile,omitempty"`
+	Width         int               `json:"width,omitempty"`
+	Height        int               `json:"height,omitempty"`
+	FrameRate     *Rational         `json:"frame_rate,omitempty"`
+	PixelFormat   string            `json:"pixel_format,omitempty"`
+	BitRate       int64             `json:"bit_rate,omitempty"`
+	Language      string            `json:"language,omitempty"`
+	Channels      int               `json:"channels,omitempty"`
+	ChannelLayout string            `json:"channel_layout,omitempty"`
+	SampleRate    int               `json:"sample_rate,omitempty"`
+	Duration      float64           `json:"duration,omitempty"`
+	Default       bool              `json:"default,omitempty"`
+	CoverArt      bool              `json:"cover_art,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+type ChapterInfo struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Title string  `json:"title,omitempty"`
+}
+
+// Frame rates are kept exact, 29.97 fps is 30000/1001
+type Rational struct {
+	Numerator   int
+	Denominator int
+}
+
+// The parts of ffprobe's JSON output that are used, numbers are mostly strings
+type ffprobeOutput struct {
+	Streams []struct {
+		Index         int               `json:"index"`
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		Profile       string            `json:"profile"`
+		Width         int               `json:"width"`
+		Height        int               `json:"height"`
+		PixFmt        string            `json:"pix_fmt"`
+		AvgFrameRate  string            `json:"avg_frame_rate"`
+		RFrameRate    string            `json:"r_frame_rate"`
+		BitRate       string            `json:"bit_rate"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		SampleRate    string            `json:"sample_rate"`
+		Duration      string            `json:"duration"`
+		Disposition   map[string]int    `json:"disposition"`
+		Tags          map[string]string `json:"tags"`
+	} `json:"streams"`
+	Chapters []struct {
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+	Format struct {
+		FormatName     string            `json:"format_name"`
+		FormatLongName string            `json:"format_long_name"`
+		Duration       string            `json:"duration"`
+		Size           string            `json:"size"`
+		BitRate        string            `json:"bit_rate"`
+		Tags           map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+func ParseRational(value string) *Rational {
+	numeratorText, denominatorText, _ := strings.Cut(value, "/")
+	numerator, _ := strconv.Atoi(numeratorText)
+	denominator, err := strconv.Atoi(denominatorText)
+	if err != nil {
+		denominator = 1
+	}
+	// ffprobe reports 0/0 when it doesn't know
+	if numerator <= 0 || denominator <= 0 {
+		return nil
+	}
+	return &Rational{numerator, denominator}
+}
+
+func (rational Rational) Float() float64 {
+	return float64(rational.Numerator) / float64(rational.Denominator)
+}
+
+func (rational Rational) String() string {
+	if rational.Denominator == 1 {
+		return strconv.Itoa(rational.Numerator)
+	}
+	return fmt.Sprintf("%d/%d", rational.Numerator, rational.Denominator)
+}
+
+func (rational Rational) MarshalText() ([]byte, error) {
+	return []byte(rational.String()), nil
+}
+
+func (rational *Rational) UnmarshalText(text []byte) error {
+	parsed := ParseRational(string(text))
+	if parsed == nil {
+		return fmt.Errorf("'%s' is not a fraction", text)
+	}
+	*rational = *parsed
+	return nil
+}
+
+// Finds the fraction ffmpeg would use, e.g. 30000/1001 for the ntsc rate
+func RationalFromFloat(value float64) *Rational {
+	for _, denominator := range []int{1, 1001, 1000000} {
+		numerator := math.Round(value * float64(denominator))
+		if math.Abs(numerator/float64(denominator)-value) < 1e-9 {
+			return &Rational{int(numerator), denominator}
+		}
+	}
+	return &Rational{int(math.Round(value * 1000000)), 1000000}
+}
+
+// Generated sources are described by their parameters, everything else is probed
+func Probe(path string) (MediaInfo, error) {
+	if IsLavfi(path) {
+		lavfi, err := ParseLavfiSource(path)
+		if err != nil {
+			return MediaInfo{}, err
+		}
+		return lavfiMediaInfo(path, lavfi), nil
+	}
+	return probeFile(path)
+}
+
+// Describes a video from the header ffmpeg prints about its input, for inputs ffprobe can't read
+// because they can only be read once. The duration is 0 when it is unknown, for example for pipes.
+func ParseFfmpegHeader(path string, header string) (MediaInfo, bool) {
+	// if the resolution isnt found its likely not a video
+	matches := regexp.MustCompile(`, (\d+)x(\d+)[, ]`).FindStringSubmatch(header)
+	if len(matches) == 0 {
+		return MediaInfo{}, false
+	}
+	width, _ := strconv.Atoi(matches[1])
+	height, _ := strconv.Atoi(matches[2])
+
+	matches = regexp.MustCompile(`\b(\d+(?:\.\d+)?)\s*fps\b`).FindStringSubmatch(header)
+	if len(matches) == 0 {
+		return MediaInfo{}, false
+	}
+	fps, _ := strconv.ParseFloat(matches[1], 64)
+	if fps == 0 {
+		return MediaInfo{}, false
+	}
+
+	var duration float64
+	matches = regexp.MustCompile(`Duration:\s+(\d{2}):(\d{2}):(\d{2}\.\d{2})`).FindStringSubmatch(header)
+	if len(matches) > 0 {
+		hours, _ := strconv.Atoi(matches[1])
+		minutes, _ := strconv.Atoi(matches[2])
+		seconds, _ := strconv.ParseFloat(matches[3], 64)
+		duration = float64(hours*3600+minutes*60) + seconds
+	}
+	return MediaInfo{
+		Path:     path,
+		Format:   "stream",
+		Duration: duration,
+		Streams: []StreamInfo{{
+			Type:        "video",
+			Codec:       "rawvideo",
+			Width:       width,
+			Height:      height,
+			FrameRate:   RationalFromFloat(fps),
+			PixelFormat: "gray",
+			Duration:    duration,
+			Default:     true,
+		}},
+		Chapters: []ChapterInfo{},
+	}, true
+}
+
+func probeFile(path string) (MediaInfo, error) {
+	args := []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams", "-show_chapters"}
+	cmd := exec.Command("ffprobe", append(args, InputArgs(path)...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return MediaInfo{}, errors.New(message)
+		}
+		return MediaInfo{}, err
+	}
+	return ParseProbeOutput(path, output)
+}
+
+func ParseProbeOutput(path string, output []byte) (MediaInfo, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return MediaInfo{}, err
+	}
+	info := MediaInfo{
+		Path:       path,
+		Format:     probe.Format.FormatName,
+		FormatName: probe.Format.FormatLongName,
+		Duration:   parseProbeFloat(probe.Format.Duration),
+		Size:       parseProbeInt(probe.Format.Size),
+		BitRate:    parseProbeInt(probe.Format.BitRate),
+		Streams:    []StreamInfo{},
+		Chapters:   []ChapterInfo{},
+		Tags:       probe.Format.Tags,
+	}
+	for _, stream := range probe.Streams {
+		streamInfo := StreamInfo{
+			Index:         stream.Index,
+			Type:          stream.CodecType,
+			Codec:         stream.CodecName,
+			Profile:       stream.Profile,
+			Width:         stream.Width,
+			Height:        stream.Height,
+			PixelFormat:   stream.PixFmt,
+			BitRate:       parseProbeInt(stream.BitRate),
+			Language:      stream.Tags["language"],
+			Channels:      stream.Channels,
+			ChannelLayout: stream.ChannelLayout,
+			SampleRate:    int(parseProbeInt(stream.SampleRate)),
+			Duration:      parseProbeFloat(stream.Duration),
+			Default:       stream.Disposition["default"] == 1,
+			CoverArt:      stream.Disposition["attached_pic"] == 1,
+			Tags:          stream.Tags,
+		}
+		if stream.CodecType == "video" && !streamInfo.CoverArt {
+			// the average rate matches what is decoded, the real base rate is a fallback
+			streamInfo.FrameRate = ParseRational(stream.AvgFrameRate)
+			if streamInfo.FrameRate == nil {
+				streamInfo.FrameRate = ParseRational(stream.RFrameRate)
+			}
+		}
+		info.Streams = append(info.Streams, streamInfo)
+	}
+	for _, chapter := range probe.Chapters {
+		info.Chapters = append(info.Chapters, ChapterInfo{
+			Start: parseProbeFloat(chapter.StartTime),
+			End:   parseProbeFloat(chapter.EndTime),
+			Title: chapter.Tags["title"],
+		})
+	}
+	return info, nil
+}
+
+// ffprobe reports unknown values as N/A
+func parseProbeFloat(value string) float64 {
+	number, _ := strconv.ParseFloat(value, 64)
+	return number
+}
+
+func parseProbeInt(value string) int64 {
+	number, _ := strconv.ParseInt(value, 10, 64)
+	return number
+}
+
+func lavfiMediaInfo(path string, lavfi LavfiSource) MediaInfo {
+	return MediaInfo{
+		Path:       path,
+		Format:     "lavfi",
+		FormatName: "Libavfilter virtual input device",
+		Duration:   lavfi.duration.Seconds(),
+		Streams: []StreamInfo{{
+			Type:        "video",
+			Codec:       "rawvideo",
+			Width:       lavfi.width,
+			Height:      lavfi.height,
+			FrameRate:   RationalFromFloat(lavfi.fps),
+			PixelFormat: "rgb24",
+			Duration:    lavfi.duration.Seconds(),
+			Default:     true,
+		}},
+		Chapters: []ChapterInfo{},
+		Tags:     map[string]string{"graph": lavfi.graph},
+	}
+}
+
+// The stream that is played, cover art of audio files doesn't count
+func PlayedStream(info *MediaInfo) *StreamInfo {
+	for i := range info.Streams {
+		stream := &info.Streams[i]
+		if stream.Type == "video" && !stream.CoverArt && stream.FrameRate != nil && stream.Width > 0 {
+			return stream
+		}
+	}
+	return nil
+}
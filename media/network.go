@@ -0,0 +1,26 @@
+package media
+
+import (
+	"regexp"
+	"strings"
+)
+
+var URL_REGEX = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+
+// Whether the path is a URL ffmpeg reads over the network, like http, hls, rtsp or udp
+func IsUrl(path string) bool {
+	return URL_REGEX.MatchString(path) && !strings.HasPrefix(strings.ToLower(path), "file://")
+}
+
+// Input options that let ffmpeg recover from dropped http connections by itself
+func NetworkArgs(path string) []string {
+	lowerPath := strings.ToLower(path)
+	if strings.HasPrefix(lowerPath, "http://") || strings.HasPrefix(lowerPath, "https://") {
+		return []string{
+			"-reconnect", "1",
+			"-reconnect_streamed", "1",
+			"-reconnect_delay_max", "30",
+		}
+	}
+	return []string{}
+}
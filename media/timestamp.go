@@ -0,0 +1,29 @@
+package media
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parses "h:mm:ss" or "m:ss" (with optional fractional seconds) into seconds.
+func ParseTimestamp(input string) (float64, error) {
+	parts := strings.Split(input, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp '%s'", input)
+	}
+
+	var seconds float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid timestamp '%s'", input)
+		}
+		// only the first part may exceed 59
+		if i > 0 && value >= 60 {
+			return 0, fmt.Errorf("invalid timestamp '%s'", input)
+		}
+		seconds = seconds*60 + value
+	}
+	return seconds, nil
+}
@@ -0,0 +1,35 @@
+package media
+
+import "testing"
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		input   string
+		seconds float64
+		wantErr bool
+	}{
+		{"0:00", 0, false},
+		{"1:23", 83, false},
+		{"1:23.5", 83.5, false},
+		{"1:02:03", 3723, false},
+		{"120:00", 7200, false},
+		{"45", 45, false},
+		{"1:60", 0, true},
+		{"1:00:60", 0, true},
+		{"1:2:3:4", 0, true},
+		{"a:00", 0, true},
+		{"1:-5", 0, true},
+		{":30", 0, true},
+		{"", 0, true},
+	}
+	for _, test := range tests {
+		seconds, err := ParseTimestamp(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseTimestamp(%q) error = %v, want error %v", test.input, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && seconds != test.seconds {
+			t.Errorf("ParseTimestamp(%q) = %g, want %g", test.input, seconds, test.seconds)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"cli-video-player/media"
+)
+
+// The Video is empty when nothing in the file can be played
+func videoFromMedia(info *media.MediaInfo, decoder media.Decoder) Video {
+	stream := media.PlayedStream(info)
+	if stream == nil {
+		return Video{}
+	}
+	seconds := info.Duration
+	if seconds == 0 {
+		seconds = stream.Duration
+	}
+	fps := stream.FrameRate.Float()
+	return Video{
+		filepath:    info.Path,
+		duration:    time.Duration(seconds * float64(time.Second)),
+		width:       stream.Width,
+		height:      stream.Height,
+		fps:         fps,
+		totalFrames: int(seconds * fps),
+		decoder:     decoder,
+	}
+}
+
+// Shows the container, streams, chapters and tags of a file
+func runInfo(args []string) {
+	flags := newFlagSet("info")
+	asJson := flags.Bool("json", false, "print the information as JSON")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return
+	}
+	if len(args) != 1 {
+		printUsageError(flags.Name(), "Expected one video, got", len(args), "arguments.")
+		return
+	}
+	path := args[0]
+	if _, err := os.Stat(path); err != nil && !media.IsLavfi(path) && !media.IsUrl(path) {
+		printError("File '" + path + "' could not be found.")
+		return
+	}
+	info, err := media.Probe(path)
+	if err != nil {
+		printError("'"+path+"' could not be read:", err)
+		return
+	}
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(info)
+		return
+	}
+	printMediaInfo(&info)
+}
+
+func printMediaInfo(info *media.MediaInfo) {
+	fmt.Println("File:     ", info.Path)
+	format := info.Format
+	if info.FormatName != "" {
+		format += " (" + info.FormatName + ")"
+	}
+	fmt.Println("Format:   ", format)
+	if info.Duration > 0 {
+		fmt.Println("Duration: ", formatSeconds(info.Duration))
+	} else {
+		fmt.Println("Duration:  unknown")
+	}
+	if info.Size > 0 {
+		fmt.Printf("Size:      %.1f MB\n", float64(info.Size)/1e6)
+	}
+	if info.BitRate > 0 {
+		fmt.Printf("Bit rate:  %d kb/s\n", info.BitRate/1000)
+	}
+	if media.PlayedStream(info) == nil {
+		fmt.Println("Playable:  no, there is no video stream")
+	}
+
+	fmt.Println()
+	fmt.Println("Streams:")
+	for _, stream := range info.Streams {
+		fmt.Printf("  #%d %s\n", stream.Index, describeStream(&stream))
+	}
+	if len(info.Chapters) > 0 {
+		fmt.Println()
+		fmt.Println("Chapters:")
+		for _, chapter := range info.Chapters {
+			fmt.Printf("  %s - %s  %s\n", formatSeconds(chapter.Start), formatSeconds(chapter.End), chapter.Title)
+		}
+	}
+	if len(info.Tags) > 0 {
+		fmt.Println()
+		fmt.Println("Tags:")
+		printTags(info.Tags, "  ")
+	}
+}
+
+// One line like 'video: h264 (High), 1920x1080, 30000/1001 fps (29.97), yuv420p, 4800 kb/s, eng, default'
+func describeStream(stream *media.StreamInfo) string {
+	codec := stream.Codec
+	if codec == "" {
+		codec = "unknown"
+	}
+	if stream.Profile != "" {
+		codec += " (" + stream.Profile + ")"
+	}
+	parts := []string{stream.Type + ": " + codec}
+	if stream.Width > 0 {
+		parts = append(parts, fmt.Sprintf("%dx%d", stream.Width, stream.Height))
+	}
+	if stream.FrameRate != nil {
+		rate := stream.FrameRate.String() + " fps"
+		if stream.FrameRate.Denominator != 1 {
+			rate += fmt.Sprintf(" (%.2f)", stream.FrameRate.Float())
+		}
+		parts = append(parts, rate)
+	}
+	if stream.PixelFormat != "" {
+		parts = append(parts, stream.PixelFormat)
+	}
+	if stream.SampleRate > 0 {
+		parts = append(parts, fmt.Sprintf("%d Hz", stream.SampleRate))
+	}
+	if stream.Channels > 0 {
+		channels := fmt.Sprintf("%d channels", stream.Channels)
+		if stream.ChannelLayout != "" {
+			channels += " (" + stream.ChannelLayout + ")"
+		}
+		parts = append(parts, channels)
+	}
+	if stream.BitRate > 0 {
+		parts = append(parts, fmt.Sprintf("%d kb/s", stream.BitRate/1000))
+	}
+	if stream.Language != "" && stream.Language != "und" {
+		parts = append(parts, stream.Language)
+	}
+	if stream.Default {
+		parts = append(parts, "default")
+	}
+	if stream.CoverArt {
+		parts = append(parts, "cover art")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printTags(tags map[string]string, indent string) {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("%s%s: %s\n", indent, key, tags[key])
+	}
+}
+
+// Formats seconds as [H:]MM:SS.cc
+func formatSeconds(seconds float64) string {
+	centiseconds := int(seconds*100 + 0.5)
+	hours := centiseconds / 360000
+	minutes := centiseconds / 6000 % 60
+	rest := float64(centiseconds%6000) / 100
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%05.2f", hours, minutes, rest)
+	}
+	return fmt.Sprintf("%d:%05.2f", minutes, rest)
+}
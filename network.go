@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cli-video-player/media"
+)
+
+const RECONNECT_DELAY = time.Second
+const MAX_RECONNECT_DELAY = 30 * time.Second
+const MAX_RECONNECTS int = 10
+
+// Set while a lost network input is being reconnected, by whichever goroutine decodes it
+var RECONNECTING atomic.Bool
+
+// Delay before the next reconnect, doubling with every attempt
+func reconnectDelay(attempt int) time.Duration {
+	delay := RECONNECT_DELAY
+	for i := 0; i < attempt && delay < MAX_RECONNECT_DELAY; i++ {
+		delay *= 2
+	}
+	return min(delay, MAX_RECONNECT_DELAY)
+}
+
+// Retries network inputs that fail with increasing delays, continuing after the last read frame.
+// The error is returned once that fails too. Interrupt and Close stop the wait between attempts.
+type ReconnectingDecoder struct {
+	media.Decoder
+	fps       float64
+	nextFrame int
+	// a pending interrupt, reading drops interrupts that were meant for earlier reads
+	interrupted chan struct{}
+	closed      chan struct{}
+	closeOnce   sync.Once
+}
+
+func newReconnectingDecoder(decoder media.Decoder, fps float64) *ReconnectingDecoder {
+	return &ReconnectingDecoder{
+		Decoder:     decoder,
+		fps:         fps,
+		interrupted: make(chan struct{}, 1),
+		closed:      make(chan struct{}),
+	}
+}
+
+func (decoder *ReconnectingDecoder) Seek(position time.Duration) error {
+	decoder.nextFrame = int(math.Round(position.Seconds() * decoder.fps))
+	return decoder.Decoder.Seek(position)
+}
+
+func (decoder *ReconnectingDecoder) ReadFrame() (media.Frame, time.Duration, error) {
+	select {
+	case <-decoder.interrupted:
+	default:
+	}
+	for attempt := 0; ; attempt++ {
+		frame, timestamp, err := decoder.Decoder.ReadFrame()
+		if err == nil {
+			RECONNECTING.Store(false)
+			decoder.nextFrame++
+			return frame, timestamp, nil
+		}
+		if attempt >= MAX_RECONNECTS || err == io.EOF {
+			RECONNECTING.Store(false)
+			return nil, 0, err
+		}
+		RECONNECTING.Store(true)
+		select {
+		case <-time.After(reconnectDelay(attempt)):
+		case <-decoder.interrupted:
+			RECONNECTING.Store(false)
+			return nil, 0, media.ErrInterrupted
+		case <-decoder.closed:
+			RECONNECTING.Store(false)
+			return nil, 0, err
+		}
+		decoder.Decoder.Seek(time.Duration(float64(decoder.nextFrame) / decoder.fps * float64(time.Second)))
+	}
+}
+
+// Stops waiting for the next reconnect, can be called while another goroutine reads
+func (decoder *ReconnectingDecoder) Interrupt() {
+	select {
+	case decoder.interrupted <- struct{}{}:
+	default:
+	}
+}
+
+func (decoder *ReconnectingDecoder) Close() error {
+	decoder.closeOnce.Do(func() { close(decoder.closed) })
+	return decoder.Decoder.Close()
+}
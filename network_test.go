@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"cli-video-player/media"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}
+	for attempt, delay := range want {
+		if got := reconnectDelay(attempt); got != delay {
+			t.Errorf("reconnectDelay(%d) = %v, want %v", attempt, got, delay)
+		}
+	}
+}
+
+// Starts a read that fails and waits to reconnect, returning its result once stop was called
+func readWhileReconnecting(t *testing.T, stop func(decoder *ReconnectingDecoder)) error {
+	t.Helper()
+	decoder := newReconnectingDecoder(&brokenDecoder{media.NewMemoryDecoder("http://host/video.mp4", 8, 4, 10, media.PatternFrames(8, 4, 10)), 0}, 10)
+	defer decoder.Close()
+	result := make(chan error)
+	go func() {
+		_, _, err := decoder.ReadFrame()
+		result <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !RECONNECTING.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("the decoder didn't start reconnecting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stop(decoder)
+	select {
+	case err := <-result:
+		if RECONNECTING.Load() {
+			t.Error("still reconnecting after the read returned")
+		}
+		return err
+	case <-time.After(RECONNECT_DELAY / 2):
+		t.Fatal("the read kept waiting to reconnect")
+		return nil
+	}
+}
+
+func TestReconnectingDecoderInterrupt(t *testing.T) {
+	err := readWhileReconnecting(t, func(decoder *ReconnectingDecoder) { decoder.Interrupt() })
+	if !errors.Is(err, media.ErrInterrupted) {
+		t.Errorf("interrupted read returned %v, want %v", err, media.ErrInterrupted)
+	}
+}
+
+func TestReconnectingDecoderClose(t *testing.T) {
+	err := readWhileReconnecting(t, func(decoder *ReconnectingDecoder) { decoder.Close() })
+	if !errors.Is(err, errBroken) {
+		t.Errorf("read of a closed decoder returned %v, want %v", err, errBroken)
+	}
+}
+
+func TestReconnectingDecoderStaleInterrupt(t *testing.T) {
+	decoder := newReconnectingDecoder(media.NewMemoryDecoder("http://host/video.mp4", 8, 4, 10, media.PatternFrames(8, 4, 10)), 10)
+	defer decoder.Close()
+	// an interrupt while nothing waits doesn't fail later reads
+	decoder.Interrupt()
+	if _, _, err := decoder.ReadFrame(); err != nil {
+		t.Errorf("ReadFrame after an interrupt: %v", err)
+	}
+}
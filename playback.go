@@ -0,0 +1,224 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"cli-video-player/player"
+)
+
+// Playback state of what is playing. Videos are played by a player.Player, animations and
+// images by a Timeline. The play loops draw the frames.
+type Playback interface {
+	Play()
+	Pause()
+	Paused() bool
+	SeekFrame(frame int)
+	CurrentFrame() int
+	SetReverse(reverse bool)
+	Reverse() bool
+	SetSpeed(speed float64)
+	Speed() float64
+	Events() <-chan player.Event
+}
+
+// Set before playback starts, keys, the IPC socket and watch-together sessions control it
+var PLAYBACK Playback
+
+// Plays the video from the frame, the play loop shows the frames and moves on
+func openVideoPlayer(video *Video, frame int) (*player.Player, error) {
+	// the player decodes in the background, so it gets a copy that isn't replaced with the next video
+	described := *video
+	return player.OpenDecoder(video.decoder, player.Options{
+		Manual:       true,
+		StartFrame:   frame,
+		BufferOffset: BUFFER_OFFSET,
+		BufferSize:   BUFFER_SIZE,
+		Keyframe: func(frame int) (int, bool) {
+			return keyframeBefore(&THUMBNAIL_INDEX, &described, frame)
+		},
+	})
+}
+
+// The player of the playing video, nil for animations and images
+func videoPlayer() *player.Player {
+	videoPlayer, _ := PLAYBACK.(*player.Player)
+	return videoPlayer
+}
+
+func currentFrame() int {
+	if PLAYBACK == nil {
+		return 0
+	}
+	return PLAYBACK.CurrentFrame()
+}
+
+func paused() bool {
+	return PLAYBACK != nil && PLAYBACK.Paused()
+}
+
+// Seeks as far as the video can be seeked, the play loop shows the frame there
+func seekTo(frame int) {
+	PLAYBACK.SeekFrame(clampFrame(&CURRENT_VIDEO, frame))
+}
+
+func skip(direction int) {
+	seekTo(currentFrame() + direction*SKIP_AMOUNT_S*int(CURRENT_VIDEO.fps))
+}
+
+func togglePause() {
+	if PLAYBACK.Paused() {
+		PLAYBACK.Play()
+	} else {
+		PLAYBACK.Pause()
+	}
+}
+
+func toggleReverse() {
+	if CURRENT_ANIMATION != nil {
+		setStatusMessage("Reverse playback is not supported for animations")
+		return
+	}
+	if CURRENT_IMAGES != nil {
+		setStatusMessage("Reverse playback is not supported for images")
+		return
+	}
+	PLAYBACK.SetReverse(!PLAYBACK.Reverse())
+}
+
+// Runs hooks and tells IPC clients and the watch-together session about pauses and seeks.
+// Returns true when the position changed. Runs every frame.
+func handlePlaybackEvents() bool {
+	seeked := false
+	for {
+		select {
+		case event, open := <-PLAYBACK.Events():
+			if !open {
+				return seeked
+			}
+			switch event.Type {
+			case player.EVENT_SEEK:
+				seeked = true
+				SEEKED = true
+				runHook("seek")
+				emitIpcSeek()
+			case player.EVENT_PAUSE:
+				runHook("pause")
+				emitIpcPause(true)
+			case player.EVENT_RESUME:
+				runHook("resume")
+				emitIpcPause(false)
+			case player.EVENT_ERROR:
+				failPlayback(event.Err)
+			}
+		default:
+			return seeked
+		}
+	}
+}
+
+// Playback of animations and images, which only play forward
+type Timeline struct {
+	mutex        sync.Mutex
+	fps          float64
+	totalFrames  int
+	currentFrame int
+	paused       bool
+	speed        float64
+	events       chan player.Event
+}
+
+func newTimeline(video *Video, frame int) *Timeline {
+	return &Timeline{
+		fps:          video.fps,
+		totalFrames:  video.totalFrames,
+		currentFrame: frame,
+		speed:        1,
+		events:       make(chan player.Event, player.EVENT_BUFFER),
+	}
+}
+
+func (timeline *Timeline) Play() {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+	if timeline.paused {
+		timeline.paused = false
+		timeline.emit(player.EVENT_RESUME)
+	}
+}
+
+func (timeline *Timeline) Pause() {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+	if !timeline.paused {
+		timeline.paused = true
+		timeline.emit(player.EVENT_PAUSE)
+	}
+}
+
+func (timeline *Timeline) Paused() bool {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+	return timeline.paused
+}
+
+func (timeline *Timeline) SeekFrame(frame int) {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+	timeline.currentFrame = min(max(frame, 0), max(timeline.totalFrames-1, 0))
+	timeline.emit(player.EVENT_SEEK)
+}
+
+func (timeline *Timeline) CurrentFrame() int {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+	return timeline.currentFrame
+}
+
+func (timeline *Timeline) SetReverse(reverse bool) {}
+
+func (timeline *Timeline) Reverse() bool {
+	return false
+}
+
+func (timeline *Timeline) SetSpeed(speed float64) {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+	if speed > 0 {
+		timeline.speed = speed
+	}
+}
+
+func (timeline *Timeline) Speed() float64 {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+	return timeline.speed
+}
+
+func (timeline *Timeline) Events() <-chan player.Event {
+	return timeline.events
+}
+
+// Moves on to the next frame, unless paused
+func (timeline *Timeline) Advance() {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+	if !timeline.paused {
+		timeline.currentFrame++
+	}
+}
+
+// Starts over at the frame without reporting a seek, for looping
+func (timeline *Timeline) rewind(frame int) {
+	timeline.mutex.Lock()
+	defer timeline.mutex.Unlock()
+	timeline.currentFrame = frame
+}
+
+func (timeline *Timeline) emit(eventType string) {
+	position := time.Duration(float64(timeline.currentFrame) / timeline.fps * float64(time.Second))
+	select {
+	case timeline.events <- player.Event{Type: eventType, Position: position}:
+	default:
+	}
+}
@@ -0,0 +1,655 @@
+// Package player plays videos as text. Every Player owns its state, so several can play at once.
+package player
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"cli-video-player/media"
+	"cli-video-player/render"
+)
+
+// Types of the events sent on Player.Events
+const (
+	EVENT_START  = "start"
+	EVENT_PAUSE  = "pause"
+	EVENT_RESUME = "resume"
+	EVENT_SEEK   = "seek"
+	EVENT_END    = "end"
+	EVENT_ERROR  = "error"
+)
+
+// Events that are not read in time are dropped, playback never waits for them
+const EVENT_BUFFER int = 32
+
+// Frames decoded ahead of the current frame
+const BUFFER_OFFSET int = 30
+
+// Most memory a chunk of frames decoded for reverse playback takes
+const MAX_REVERSE_CHUNK_BYTES int = 256 << 20
+
+const DEFAULT_COLS int = 80
+const DEFAULT_ROWS int = 24
+
+type Event struct {
+	Type     string
+	Position time.Duration
+	Err      error
+}
+
+type Options struct {
+	// Frames are drawn here as terminal output. Without an output they are only kept for View.
+	Output   io.Writer
+	Cols     int
+	Rows     int
+	Renderer render.Renderer
+	// 1 plays in real time
+	Speed float64
+	// Manual players have no clock, the caller shows the frames of Frame and moves on with Advance.
+	// Nothing is drawn, so Output, Cols, Rows and Renderer are not used.
+	Manual bool
+	// Returns the last keyframe at or before the frame, when it is known. Reverse playback decodes
+	// from there, so every group of pictures is decoded once.
+	Keyframe func(frame int) (int, bool)
+	// Frame playback starts from
+	StartFrame int
+	// Frames decoded at once, BUFFER_OFFSET when 0
+	BufferOffset int
+	// More frames are decoded once fewer are buffered, half of BufferOffset when 0
+	BufferSize int
+}
+
+type Player struct {
+	mutex    sync.Mutex
+	info     media.MediaInfo
+	width    int
+	height   int
+	fps      float64
+	duration time.Duration
+	// math.MaxInt until the end of a video of unknown length is reached
+	totalFrames  int
+	currentFrame int
+	decoder      media.Decoder
+	decoderMutex sync.Mutex
+	keyframe     func(frame int) (int, bool)
+	// frames from currentFrame on in the playback direction
+	buffer       []media.Frame
+	bufferOffset int
+	bufferSize   int
+	decoding     bool
+	// set when a reverse chunk couldn't be decoded, seeking tries again
+	failed bool
+	// bumped on seeks, so frames of older decoders are dropped
+	generation int
+	shown      media.Frame
+	showNext   bool
+	screen     string
+	redraw     bool
+	renderer   render.Renderer
+	output     io.Writer
+	cols       int
+	rows       int
+	speed      float64
+	reverse    bool
+	manual     bool
+	running    bool
+	paused     bool
+	closed     bool
+	events     chan Event
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// Opens the video at path, which can be a file, url or lavfi source, to be decoded with ffmpeg.
+// Videos of unknown length, like live streams, play until they end. Playback starts with Play.
+func Open(path string, options Options) (*Player, error) {
+	return OpenDecoder(media.NewFfmpegDecoder(path), options)
+}
+
+// Plays the frames of any decoder, the player closes it
+func OpenDecoder(decoder media.Decoder, options Options) (*Player, error) {
+	info, err := decoder.Probe()
+	if err != nil {
+		decoder.Close()
+		return nil, err
+	}
+	stream := media.PlayedStream(&info)
+	if stream == nil {
+		decoder.Close()
+		return nil, errors.New("'" + info.Path + "' has no video stream")
+	}
+	seconds := info.Duration
+	if seconds == 0 {
+		seconds = stream.Duration
+	}
+	player := &Player{
+		info:         info,
+		decoder:      decoder,
+		width:        stream.Width,
+		height:       stream.Height,
+		fps:          stream.FrameRate.Float(),
+		duration:     time.Duration(seconds * float64(time.Second)),
+		renderer:     options.Renderer,
+		output:       options.Output,
+		cols:         options.Cols,
+		rows:         options.Rows,
+		speed:        options.Speed,
+		manual:       options.Manual,
+		keyframe:     options.Keyframe,
+		bufferOffset: options.BufferOffset,
+		bufferSize:   options.BufferSize,
+		showNext:     true,
+		events:       make(chan Event, EVENT_BUFFER),
+	}
+	player.totalFrames = int(seconds * player.fps)
+	if seconds == 0 {
+		// found once decoding reaches the end
+		player.totalFrames = math.MaxInt
+	}
+	if player.renderer == nil {
+		player.renderer = render.NewAscii()
+	}
+	if player.cols < 1 || player.rows < 1 {
+		player.cols, player.rows = DEFAULT_COLS, DEFAULT_ROWS
+	}
+	if player.speed <= 0 {
+		player.speed = 1
+	}
+	if player.bufferOffset < 1 {
+		player.bufferOffset = BUFFER_OFFSET
+	}
+	if player.bufferSize < 1 {
+		player.bufferSize = max(player.bufferOffset/2, 1)
+	}
+	player.currentFrame = min(max(options.StartFrame, 0), max(player.totalFrames-1, 0))
+	return player, nil
+}
+
+// Starts playback, resumes it when paused or starts over when the video ended
+func (player *Player) Play() {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if player.closed {
+		return
+	}
+	if player.running {
+		if player.paused {
+			player.paused = false
+			player.emit(EVENT_RESUME, nil)
+		}
+		return
+	}
+	if player.currentFrame >= player.totalFrames {
+		player.setFrame(0)
+	}
+	player.running = true
+	player.paused = false
+	if !player.manual {
+		player.stop = make(chan struct{})
+		player.done = make(chan struct{})
+		go player.run(player.stop, player.done)
+	}
+	player.emit(EVENT_START, nil)
+}
+
+func (player *Player) Pause() {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if !player.running || player.paused {
+		return
+	}
+	player.paused = true
+	player.emit(EVENT_PAUSE, nil)
+}
+
+// Jumps to the position, which is clamped to the video. Paused players show the new frame.
+func (player *Player) Seek(position time.Duration) {
+	player.SeekFrame(int(position.Seconds() * player.fps))
+}
+
+func (player *Player) SeekFrame(frame int) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if player.closed {
+		return
+	}
+	player.setFrame(min(max(frame, 0), max(player.totalFrames-1, 0)))
+	player.interrupt()
+	player.fill()
+	player.emit(EVENT_SEEK, nil)
+}
+
+// Plays backwards, until the start where the player pauses and plays forward again
+func (player *Player) SetReverse(reverse bool) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if player.closed || reverse == player.reverse {
+		return
+	}
+	player.reverse = reverse
+	// the buffered frames are in the other direction
+	player.setFrame(min(player.currentFrame, max(player.totalFrames-1, 0)))
+	player.fill()
+}
+
+func (player *Player) Reverse() bool {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.reverse
+}
+
+// 1 plays in real time, manual players only report it
+func (player *Player) SetSpeed(speed float64) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if speed > 0 {
+		player.speed = speed
+	}
+}
+
+func (player *Player) Speed() float64 {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.speed
+}
+
+// Changes how frames are drawn, the current frame is drawn again
+func (player *Player) SetRenderer(renderer render.Renderer) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	player.renderer = renderer
+	player.redrawShown()
+}
+
+// Changes the amount of characters frames are drawn with, the current frame is drawn again
+func (player *Player) SetSize(cols int, rows int) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if cols < 1 || rows < 1 {
+		return
+	}
+	player.cols, player.rows = cols, rows
+	player.redrawShown()
+}
+
+// Playback events, closed by Close
+func (player *Player) Events() <-chan Event {
+	return player.events
+}
+
+// The frame on screen as rows separated by line breaks
+func (player *Player) View() string {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return render.Lines(player.screen, player.cols)
+}
+
+func (player *Player) Position() time.Duration {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.position()
+}
+
+// Number of the next frame that is shown
+func (player *Player) CurrentFrame() int {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.currentFrame
+}
+
+// 0 when the length is unknown
+func (player *Player) Duration() time.Duration {
+	return player.duration
+}
+
+// 0 while the length is unknown
+func (player *Player) FrameCount() int {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if player.totalFrames == math.MaxInt {
+		return 0
+	}
+	return player.totalFrames
+}
+
+func (player *Player) Info() media.MediaInfo {
+	return player.info
+}
+
+func (player *Player) FrameRate() float64 {
+	return player.fps
+}
+
+func (player *Player) Paused() bool {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.paused
+}
+
+// Whether playback was started and didn't end yet
+func (player *Player) Playing() bool {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.running
+}
+
+// Whether every frame was shown
+func (player *Player) Ended() bool {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.ended()
+}
+
+// Whether playback waits for the next frame to be decoded
+func (player *Player) Buffering() bool {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.running && !player.paused && len(player.buffer) == 0 && !player.ended()
+}
+
+// The frame to show next, false while it is being decoded. Frames are shared, so they
+// must not be changed.
+func (player *Player) Frame() (media.Frame, bool) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.frame()
+}
+
+// Moves on to the next frame in the playback direction, after the frame of Frame was shown
+func (player *Player) Advance() {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if player.closed || len(player.buffer) == 0 {
+		return
+	}
+	player.advance()
+	if player.ended() && player.running {
+		player.running = false
+		player.emit(EVENT_END, nil)
+	}
+}
+
+func (player *Player) Closed() bool {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.closed
+}
+
+// Stops playback, closes the event channel and the decoder
+func (player *Player) Close() error {
+	player.mutex.Lock()
+	if player.closed {
+		player.mutex.Unlock()
+		return nil
+	}
+	player.closed = true
+	player.generation++
+	if player.running && !player.manual {
+		close(player.stop)
+	}
+	player.running = false
+	done := player.done
+	player.interrupt()
+	player.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
+	close(player.events)
+	// waits for a running decode to notice it is outdated
+	player.decoderMutex.Lock()
+	defer player.decoderMutex.Unlock()
+	return player.decoder.Close()
+}
+
+// Stops a decode that is waiting, e.g. for a network input to come back, so the decoder can be used again
+func (player *Player) interrupt() {
+	if interrupter, ok := player.decoder.(media.Interrupter); ok {
+		interrupter.Interrupt()
+	}
+}
+
+func (player *Player) run(stop chan struct{}, done chan struct{}) {
+	defer close(done)
+	for {
+		startFrameTime := time.Now()
+		player.mutex.Lock()
+		playing := player.step()
+		frameTime := time.Duration(float64(time.Second) / player.fps / player.speed)
+		player.mutex.Unlock()
+		if !playing {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(frameTime - time.Since(startFrameTime)):
+		}
+	}
+}
+
+// Shows the next frame, returns false when the video ended. Called with the lock held.
+func (player *Player) step() bool {
+	frame, buffered := player.frame()
+	if player.paused {
+		if player.showNext && buffered {
+			player.draw(frame)
+			player.showNext = false
+		}
+		return true
+	}
+	if player.ended() {
+		player.running = false
+		player.emit(EVENT_END, nil)
+		return false
+	}
+	if !buffered {
+		return true
+	}
+	player.draw(frame)
+	player.showNext = false
+	player.advance()
+	return true
+}
+
+func (player *Player) frame() (media.Frame, bool) {
+	player.fill()
+	if len(player.buffer) == 0 {
+		return nil, false
+	}
+	return player.buffer[0], true
+}
+
+func (player *Player) advance() {
+	player.buffer = player.buffer[1:]
+	if !player.reverse {
+		player.currentFrame++
+		return
+	}
+	if player.currentFrame > 0 {
+		player.currentFrame--
+		return
+	}
+	// reverse playback stops at the start
+	player.reverse = false
+	player.paused = true
+	player.setFrame(0)
+	player.emit(EVENT_PAUSE, nil)
+}
+
+func (player *Player) ended() bool {
+	return player.currentFrame >= player.totalFrames
+}
+
+// Decodes the next frames in the background when the buffer runs low
+func (player *Player) fill() {
+	if player.closed || player.decoding || player.failed || len(player.buffer) >= player.bufferSize {
+		return
+	}
+	if player.reverse {
+		endFrame := player.currentFrame - len(player.buffer)
+		if endFrame < 0 {
+			return
+		}
+		player.decoding = true
+		go player.decodeReverse(player.reverseChunkStart(endFrame), endFrame, player.generation)
+		return
+	}
+	next := player.currentFrame + len(player.buffer)
+	if next >= player.totalFrames {
+		return
+	}
+	player.decoding = true
+	go player.decode(next, min(player.bufferOffset, player.totalFrames-next), player.generation)
+}
+
+func (player *Player) decode(startFrame int, frameAmount int, generation int) {
+	// decoders of older generations stop at their next frame
+	player.decoderMutex.Lock()
+	if player.outdated(generation) {
+		player.decoderMutex.Unlock()
+		return
+	}
+	decoded := 0
+	err := media.ReadFrames(player.decoder, player.fps, startFrame, frameAmount, func(frame media.Frame) bool {
+		player.mutex.Lock()
+		defer player.mutex.Unlock()
+		if player.generation != generation {
+			return false
+		}
+		player.buffer = append(player.buffer, frame)
+		decoded++
+		return true
+	})
+	player.decoderMutex.Unlock()
+
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if player.generation != generation {
+		return
+	}
+	player.decoding = false
+	if err != nil {
+		player.emit(EVENT_ERROR, err)
+		// the rest of the video can't be decoded
+		player.totalFrames = player.currentFrame + len(player.buffer)
+	} else if decoded < frameAmount {
+		// the video is shorter than its duration said, or its length was unknown
+		player.totalFrames = startFrame + decoded
+	}
+}
+
+// Decodes the frames from startFrame to endFrame and buffers them backwards
+func (player *Player) decodeReverse(startFrame int, endFrame int, generation int) {
+	player.decoderMutex.Lock()
+	if player.outdated(generation) {
+		player.decoderMutex.Unlock()
+		return
+	}
+	chunk := make([]media.Frame, 0, endFrame-startFrame+1)
+	err := media.ReadFrames(player.decoder, player.fps, startFrame, endFrame-startFrame+1, func(frame media.Frame) bool {
+		chunk = append(chunk, frame)
+		return !player.outdated(generation)
+	})
+	player.decoderMutex.Unlock()
+
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	if player.generation != generation {
+		return
+	}
+	player.decoding = false
+	if err != nil {
+		player.emit(EVENT_ERROR, err)
+		player.failed = true
+		return
+	}
+	if len(chunk) < endFrame-startFrame+1 {
+		// the video ends before the frame reverse playback started at
+		player.totalFrames = startFrame + len(chunk)
+		player.setFrame(max(player.totalFrames-1, 0))
+		return
+	}
+	for i := len(chunk) - 1; i >= 0; i-- {
+		player.buffer = append(player.buffer, chunk[i])
+	}
+}
+
+// First frame of the reverse chunk that ends at endFrame. Called with the lock held.
+func (player *Player) reverseChunkStart(endFrame int) int {
+	maxFrames := max(MAX_REVERSE_CHUNK_BYTES/max(player.width*player.height*media.CHANNELS, 1), player.bufferSize)
+	startFrame := endFrame - player.bufferOffset + 1
+	if player.keyframe != nil {
+		if keyframe, exists := player.keyframe(endFrame); exists && keyframe <= endFrame {
+			startFrame = keyframe
+		}
+	}
+	// groups of pictures that don't fit are decoded from their keyframe once per chunk
+	return max(startFrame, endFrame-maxFrames+1, 0)
+}
+
+func (player *Player) outdated(generation int) bool {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+	return player.generation != generation
+}
+
+// Drops the buffer and the frames of running decoders
+func (player *Player) setFrame(frame int) {
+	player.generation++
+	player.buffer = nil
+	player.decoding = false
+	player.failed = false
+	player.currentFrame = frame
+	player.showNext = true
+}
+
+func (player *Player) draw(frame media.Frame) {
+	screen := player.renderer.Render(frame, player.width, player.height, player.cols, player.rows)
+	if player.output != nil {
+		if player.redraw || len(screen) != len(player.screen) {
+			player.output.Write([]byte(fullFrame(screen, player.cols)))
+		} else {
+			player.output.Write([]byte(render.FrameDiff(player.screen, screen, player.cols, 0)))
+		}
+	}
+	player.shown = frame
+	player.screen = screen
+	player.redraw = false
+}
+
+func (player *Player) redrawShown() {
+	player.redraw = true
+	if player.shown != nil {
+		player.draw(player.shown)
+	}
+}
+
+func (player *Player) position() time.Duration {
+	return time.Duration(float64(player.currentFrame) / player.fps * float64(time.Second))
+}
+
+func (player *Player) emit(eventType string, err error) {
+	// the channel is closed, or about to be
+	if player.closed {
+		return
+	}
+	select {
+	case player.events <- Event{Type: eventType, Position: player.position(), Err: err}:
+	default:
+	}
+}
+
+// Draws every row of the frame at the top of the terminal
+func fullFrame(screen string, cols int) string {
+	var output strings.Builder
+	for row := 0; row*cols < len(screen); row++ {
+		output.WriteString(render.GotoCharacter(1, row))
+		output.WriteString(screen[row*cols : min((row+1)*cols, len(screen))])
+	}
+	return output.String()
+}
@@ -0,0 +1,227 @@
+package player
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"cli-video-player/media"
+)
+
+func openMemoryPlayer(t *testing.T, frames int) *Player {
+	t.Helper()
+	decoder := media.NewMemoryDecoder("memory", 8, 4, 25, media.PatternFrames(8, 4, frames))
+	player, err := OpenDecoder(decoder, Options{Cols: 8, Rows: 4})
+	if err != nil {
+		t.Fatalf("OpenDecoder: %v", err)
+	}
+	return player
+}
+
+func TestControlsAfterClose(t *testing.T) {
+	player := openMemoryPlayer(t, 50)
+	player.Play()
+	if err := player.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// none of these may send on the closed event channel
+	player.Pause()
+	player.Play()
+	player.Seek(0)
+	if player.Playing() {
+		t.Error("a closed player is still playing")
+	}
+	if err := player.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func openManualPlayer(t *testing.T, decoder media.Decoder, keyframe func(int) (int, bool)) *Player {
+	t.Helper()
+	player, err := OpenDecoder(decoder, Options{Manual: true, Keyframe: keyframe})
+	if err != nil {
+		t.Fatalf("OpenDecoder: %v", err)
+	}
+	t.Cleanup(func() { player.Close() })
+	player.Play()
+	return player
+}
+
+// Waits for the frame decoded in the background
+func waitForFrame(t *testing.T, player *Player) media.Frame {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if frame, buffered := player.Frame(); buffered {
+			return frame
+		}
+		if player.Ended() {
+			t.Fatal("the player ended while waiting for a frame")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("timed out waiting for a frame")
+	return nil
+}
+
+// Plays frames with Frame and Advance, returning the frame numbers they came from
+func playFrames(t *testing.T, player *Player, amount int) []int {
+	t.Helper()
+	expected := media.PatternFrames(8, 4, 100)
+	var numbers []int
+	for i := 0; i < amount; i++ {
+		frame := waitForFrame(t, player)
+		numbers = append(numbers, slices.IndexFunc(expected, func(candidate media.Frame) bool {
+			return bytes.Equal(candidate, frame)
+		}))
+		player.Advance()
+	}
+	return numbers
+}
+
+func TestManualPlayback(t *testing.T) {
+	player := openManualPlayer(t, media.NewMemoryDecoder("memory", 8, 4, 25, media.PatternFrames(8, 4, 40)), nil)
+	if got := playFrames(t, player, 40); !slices.Equal(got, sequence(0, 40, 1)) {
+		t.Errorf("played frames %v, want 0 to 39", got)
+	}
+	if !player.Ended() || player.Playing() {
+		t.Error("the player didn't end after the last frame")
+	}
+
+	player.SeekFrame(10)
+	player.Play()
+	if got := playFrames(t, player, 3); !slices.Equal(got, []int{10, 11, 12}) {
+		t.Errorf("played frames %v after seeking, want 10 to 12", got)
+	}
+}
+
+func TestReversePlayback(t *testing.T) {
+	decoder := media.NewMemoryDecoder("memory", 8, 4, 25, media.PatternFrames(8, 4, 100))
+	// a keyframe every 12 frames
+	keyframe := func(frame int) (int, bool) { return frame - frame%12, true }
+	player := openManualPlayer(t, decoder, keyframe)
+	player.SeekFrame(70)
+	player.SetReverse(true)
+	if got := playFrames(t, player, 71); !slices.Equal(got, sequence(70, -1, -1)) {
+		t.Errorf("played frames %v in reverse, want 70 to 0", got)
+	}
+	// reverse playback stops at the start
+	if !player.Paused() || player.Reverse() || player.CurrentFrame() != 0 {
+		t.Errorf("after playing back to the start: paused %v, reverse %v, frame %d", player.Paused(), player.Reverse(), player.CurrentFrame())
+	}
+}
+
+func TestReverseChunkStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		height   int
+		keyframe func(int) (int, bool)
+		endFrame int
+		want     int
+	}{
+		{"keyframe before", 64, 48, func(int) (int, bool) { return 120, true }, 200, 120},
+		{"on a keyframe", 64, 48, func(int) (int, bool) { return 120, true }, 120, 120},
+		{"unknown keyframe", 64, 48, func(int) (int, bool) { return 0, false }, 300, 300 - BUFFER_OFFSET + 1},
+		{"no keyframes", 64, 48, nil, 300, 300 - BUFFER_OFFSET + 1},
+		{"at the start", 64, 48, nil, 10, 0},
+		// 32 frames of 4K fit in the memory limit
+		{"large frames", 3840, 2160, func(int) (int, bool) { return 120, true }, 239, 239 - 32 + 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			player := &Player{width: test.width, height: test.height, keyframe: test.keyframe, bufferOffset: BUFFER_OFFSET, bufferSize: BUFFER_OFFSET / 2}
+			if got := player.reverseChunkStart(test.endFrame); got != test.want {
+				t.Errorf("reverseChunkStart(%d) = %d, want %d", test.endFrame, got, test.want)
+			}
+		})
+	}
+}
+
+// Describes the video without a duration, like a live stream
+type unknownLengthDecoder struct {
+	*media.MemoryDecoder
+}
+
+func (decoder unknownLengthDecoder) Probe() (media.MediaInfo, error) {
+	info, err := decoder.MemoryDecoder.Probe()
+	info.Duration = 0
+	info.Streams[0].Duration = 0
+	return info, err
+}
+
+func TestUnknownLength(t *testing.T) {
+	player := openManualPlayer(t, unknownLengthDecoder{media.NewMemoryDecoder("live", 8, 4, 25, media.PatternFrames(8, 4, 45))}, nil)
+	if player.Duration() != 0 || player.FrameCount() != 0 {
+		t.Fatalf("duration %v and %d frames before the end, want both unknown", player.Duration(), player.FrameCount())
+	}
+	if got := playFrames(t, player, 45); !slices.Equal(got, sequence(0, 45, 1)) {
+		t.Errorf("played frames %v, want 0 to 44", got)
+	}
+	// the end is found by decoding past it
+	deadline := time.Now().Add(5 * time.Second)
+	for !player.Ended() && time.Now().Before(deadline) {
+		player.Frame()
+		time.Sleep(time.Millisecond)
+	}
+	if !player.Ended() || player.FrameCount() != 45 {
+		t.Errorf("ended %v with %d frames, want the end at 45 frames", player.Ended(), player.FrameCount())
+	}
+}
+
+func sequence(start int, end int, step int) []int {
+	var numbers []int
+	for i := start; i != end; i += step {
+		numbers = append(numbers, i)
+	}
+	return numbers
+}
+
+// Blocks in ReadFrame once after the first frames until it is interrupted, like a network input waiting to reconnect
+type waitingDecoder struct {
+	*media.MemoryDecoder
+	frames      int
+	interrupted chan struct{}
+}
+
+func (decoder *waitingDecoder) ReadFrame() (media.Frame, time.Duration, error) {
+	if decoder.frames == 0 {
+		decoder.frames = -1
+		<-decoder.interrupted
+		return nil, 0, media.ErrInterrupted
+	}
+	decoder.frames--
+	return decoder.MemoryDecoder.ReadFrame()
+}
+
+func (decoder *waitingDecoder) Interrupt() {
+	select {
+	case decoder.interrupted <- struct{}{}:
+	default:
+	}
+}
+
+func TestInterruptWaitingDecoder(t *testing.T) {
+	decoder := &waitingDecoder{media.NewMemoryDecoder("memory", 8, 4, 25, media.PatternFrames(8, 4, 100)), 5, make(chan struct{}, 1)}
+	player := openManualPlayer(t, decoder, nil)
+	playFrames(t, player, 5)
+	// the decode waits now, seeking has to get past it
+	player.SeekFrame(50)
+	if got := playFrames(t, player, 3); !slices.Equal(got, []int{50, 51, 52}) {
+		t.Errorf("played frames %v after seeking, want 50 to 52", got)
+	}
+}
+
+func TestCloseWaitingDecoder(t *testing.T) {
+	decoder := &waitingDecoder{media.NewMemoryDecoder("memory", 8, 4, 25, media.PatternFrames(8, 4, 100)), 5, make(chan struct{}, 1)}
+	player := openManualPlayer(t, decoder, nil)
+	playFrames(t, player, 5)
+	closed := make(chan error)
+	go func() { closed <- player.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the decoder")
+	}
+}
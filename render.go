@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cli-video-player/media"
+)
+
+type AsciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Duration  float64           `json:"duration,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Renders a video offline to an asciinema asciicast v2 recording
+func runRender(args []string) {
+	flags := newFlagSet("render")
+	cols := flags.Int("cols", 80, "width of the recording in characters")
+	rows := flags.Int("rows", 24, "height of the recording in characters")
+	output := flags.String("o", "", "output file (default '<video name>.cast')")
+	menu := flags.Bool("menu", false, "include the menu and progress bar")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return
+	}
+	if len(args) != 1 {
+		printUsageError(flags.Name(), "Expected one video to render, got", len(args), "arguments.")
+		return
+	}
+	path := args[0]
+	if *cols < 1 || *rows < 4 {
+		printError("--cols has to be at least 1 and --rows at least 4.")
+		return
+	}
+	if _, err := os.Stat(path); err != nil && !media.IsLavfi(path) {
+		printError("File '" + path + "' could not be found.")
+		return
+	}
+	CURRENT_VIDEO = loadVideo(path)
+	if CURRENT_VIDEO.fps == 0 {
+		printError("'" + path + "' is not a valid video.")
+		return
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".cast"
+	}
+
+	startTime := time.Now()
+	frames, err := renderAsciicast(&CURRENT_VIDEO, *output, *cols, *rows, *menu)
+	if err != nil {
+		printError("Could not render '"+path+"':", err)
+		return
+	}
+	fmt.Printf("%s Rendered %d frames to '%s' in %s.\n", PREFIX, frames, *output, time.Since(startTime).Round(time.Millisecond))
+}
+
+// Writes every frame of the video as an asciicast event, timed by the frame rate.
+// Returns the amount of rendered frames.
+func renderAsciicast(video *Video, output string, cols int, rows int, menu bool) (int, error) {
+	file, err := os.Create(output)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+
+	header, _ := json.Marshal(AsciicastHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: time.Now().Unix(),
+		Duration:  video.duration.Seconds(),
+		Title:     filepath.Base(video.filepath),
+		Env:       map[string]string{"TERM": "xterm-256color"},
+	})
+	writer.Write(append(header, '\n'))
+
+	// the renderers draw at the terminal dimensions
+	TERMINAL_WIDTH = cols
+	TERMINAL_HEIGHT = rows
+
+	var oldFrame *string
+	var writeErr error
+	// the menu shows the position of the timeline
+	timeline := newTimeline(video, 0)
+	PLAYBACK = timeline
+	err = decodeVideo(video, 0, video.totalFrames, func(frame Frame) bool {
+		newFrame := processFrame(&frame, video.width, video.height, CHANNELS)
+
+		var data string
+		if oldFrame == nil {
+			data = "\033[2J\033[H"
+			if menu {
+				data += formatFrame(newFrame)
+			} else {
+				data += gotoCharacter(0, 1) + *newFrame
+			}
+		} else {
+			data = getFrameDiff(oldFrame, newFrame)
+		}
+		if menu {
+			data += renderMenu() + "\033[0;0H"
+		}
+		oldFrame = newFrame
+
+		var seconds float64 = math.Round(float64(timeline.CurrentFrame())/video.fps*1e6) / 1e6
+		event, _ := json.Marshal([]any{seconds, "o", data})
+		if _, err := writer.Write(append(event, '\n')); err != nil {
+			writeErr = err
+			return false
+		}
+		timeline.Advance()
+		return true
+	})
+	if err != nil {
+		return timeline.CurrentFrame(), err
+	}
+	if writeErr != nil {
+		return timeline.CurrentFrame(), writeErr
+	}
+	return timeline.CurrentFrame(), writer.Flush()
+}
@@ -0,0 +1,109 @@
+// Package render turns decoded frames into text for terminals.
+package render
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// var DEFAULT_CHARACTERS string = "$@B%8&WM#*oahkbdpqwmZO0QLCJUYXzcvunxrjft/()1{}[]?-_+~<>i!lI;:,^`'. "
+const DEFAULT_CHARACTERS string = "%@#*+=-:. "
+const DEFAULT_GAMMA float64 = 0.8
+
+// Draws a gray frame of width x height pixels as cols x rows characters, without line breaks
+type Renderer interface {
+	Render(frame []byte, width int, height int, cols int, rows int) string
+}
+
+// Picks characters by brightness, from dark to light
+type Ascii struct {
+	Characters string
+	Gamma      float64
+}
+
+func NewAscii() *Ascii {
+	return &Ascii{Characters: DEFAULT_CHARACTERS, Gamma: DEFAULT_GAMMA}
+}
+
+func (ascii *Ascii) Render(frame []byte, width int, height int, cols int, rows int) string {
+	return FrameToAscii(frame, width, height, 1, ascii.Characters, ascii.Gamma, cols, rows)
+}
+
+// Converts a frame to ASCII with cols x rows characters (without line breaks)
+func FrameToAscii(frame []byte, width int, height int, channels int, characters string, gamma float64, cols int, rows int) string {
+	var pixelWidth float32 = float32(width) / float32(cols)
+	var pixelHeight float32 = float32(height) / float32(rows)
+
+	var screen strings.Builder
+	screen.Grow(cols * rows)
+
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			var x int = int(pixelWidth * float32(col))
+			var y int = int(pixelHeight * float32(row))
+
+			var sampleHeight int = max(int(pixelHeight), 1)
+			var sampleWidth int = max(int(pixelWidth), 1)
+
+			var brightnessSum int
+			for pixelRow := 0; pixelRow < sampleHeight; pixelRow++ {
+				for pixelCol := 0; pixelCol < sampleWidth; pixelCol++ {
+					var localIndex int = (((y + pixelRow) * width) + x + pixelCol) * channels
+					brightnessSum += int(frame[localIndex])
+				}
+			}
+
+			var averageBrightness float64 = float64(brightnessSum / (sampleHeight * sampleWidth))
+			var normalizedBrightness float64 = averageBrightness / 255.0
+			var gammaCorrectedBrightness = math.Pow(normalizedBrightness, gamma)
+
+			var charIndex = int((1 - gammaCorrectedBrightness) * float64(len(characters)-1))
+			screen.WriteByte(characters[charIndex])
+		}
+	}
+	return screen.String()
+}
+
+// Gets the difference between 2 ASCII frames that are cols characters wide and start at terminal row top.
+// Result also contains escape characters to move cursor to right locations.
+// This results in having to print less characters to the screen.
+func FrameDiff(oldFrame string, newFrame string, cols int, top int) string {
+	var diff strings.Builder
+	var prevCharEqual bool = true
+
+	for char := 0; char < len(oldFrame); char++ {
+		if oldFrame[char] != newFrame[char] {
+			if prevCharEqual {
+				currentLine := int(char / cols)
+				currentChar := int(char % cols)
+				diff.WriteString(GotoCharacter(currentChar+1, currentLine+top))
+			}
+			diff.WriteByte(newFrame[char])
+			prevCharEqual = false
+			continue
+		}
+		prevCharEqual = true
+	}
+
+	return diff.String()
+}
+
+// Splits a frame into rows of cols characters
+func Lines(frame string, cols int) string {
+	if cols < 1 {
+		return ""
+	}
+	var lines strings.Builder
+	for start := 0; start < len(frame); start += cols {
+		if start > 0 {
+			lines.WriteByte('\n')
+		}
+		lines.WriteString(frame[start:min(start+cols, len(frame))])
+	}
+	return lines.String()
+}
+
+func GotoCharacter(x int, y int) string {
+	return fmt.Sprintf("\033[%d;%dH", y+1, x)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cli-video-player/media"
+	"golang.org/x/term"
+)
+
+const POSITIONS_FILE = "positions.json"
+
+// Positions closer to the start than this are not worth resuming
+const RESUME_MIN_SECONDS float64 = 5
+
+// Videos count as watched when stopped within this of the end
+const RESUME_END_SECONDS float64 = 1
+
+const RESUME_MAX_ENTRIES int = 500
+
+// Whether to resume: ask, always or never
+var RESUME_MODE string = "ask"
+
+// Frame playVideo starts at instead of START_FRAME, -1 when not resuming
+var RESUME_FRAME int = -1
+
+// Set when the position of CURRENT_VIDEO is saved when it stops
+var REMEMBER_POSITION bool = false
+
+type ResumeEntry struct {
+	Path     string    `json:"path"`
+	Position float64   `json:"position"`
+	Duration float64   `json:"duration"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Positions are keyed by path, size and modification time, so a replaced file starts over
+type ResumeState struct {
+	Positions map[string]ResumeEntry `json:"positions"`
+}
+
+// Files and urls can be resumed, generated sources and pipes can't
+func positionKey(path string) (string, bool) {
+	if media.IsUrl(path) {
+		return path, true
+	}
+	if media.IsLavfi(path) || isStream(path) {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%s|%d|%d", absolutePath, info.Size(), info.ModTime().UnixNano()), true
+}
+
+func readResumeState() ResumeState {
+	state := ResumeState{}
+	readStateFile(POSITIONS_FILE, &state)
+	if state.Positions == nil {
+		state.Positions = map[string]ResumeEntry{}
+	}
+	return state
+}
+
+func canRememberPosition(video *Video) bool {
+	_, ok := positionKey(video.filepath)
+	return ok && video.stream == nil && video.totalFrames > 0
+}
+
+// Frame the video was stopped at last time, asking first depending on RESUME_MODE.
+// Returns -1 to start from the beginning.
+func resumeFrame(video *Video) int {
+	key, ok := positionKey(video.filepath)
+	if !ok || RESUME_MODE == "never" {
+		return -1
+	}
+	entry, exists := readResumeState().Positions[key]
+	if !exists {
+		return -1
+	}
+	frame := int(entry.Position * video.fps)
+	if frame <= 0 || frame >= video.totalFrames {
+		return -1
+	}
+	if RESUME_MODE == "ask" && !askToResume(video.filepath, entry.Position) {
+		return -1
+	}
+	return frame
+}
+
+// Asks on the terminal before playback starts, without a terminal the video starts over
+func askToResume(path string, position float64) bool {
+	if !INTERACTIVE || INPUT == nil || !term.IsTerminal(int(INPUT.Fd())) {
+		return false
+	}
+	fmt.Printf("%s Resume '%s' from %s? [Y/n] ", PREFIX, filepath.Base(path), formatSeconds(position))
+	answer, _ := bufio.NewReader(INPUT).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// Stopped within RESUME_END_SECONDS of the end
+func watchedToEnd(video *Video) bool {
+	return video.fps > 0 && video.duration > 0 &&
+		float64(currentFrame())/video.fps >= video.duration.Seconds()-RESUME_END_SECONDS
+}
+
+// Saves where the video stopped, or forgets it when it was watched to the end
+func savePosition(video *Video) {
+	if !REMEMBER_POSITION || video.fps == 0 {
+		return
+	}
+	key, ok := positionKey(video.filepath)
+	if !ok {
+		return
+	}
+	position := float64(currentFrame()) / video.fps
+	finished := watchedToEnd(video)
+
+	// read again right before writing, other players could have saved in the meantime
+	state := readResumeState()
+	if finished || position < RESUME_MIN_SECONDS {
+		if _, exists := state.Positions[key]; !exists {
+			return
+		}
+		delete(state.Positions, key)
+	} else {
+		state.Positions[key] = ResumeEntry{
+			Path:     video.filepath,
+			Position: position,
+			Duration: video.duration.Seconds(),
+			Updated:  time.Now(),
+		}
+		prunePositions(&state)
+	}
+	if err := writeStateFile(POSITIONS_FILE, state); err != nil {
+		fmt.Println(PREFIX, "Could not save the position:", err)
+	}
+}
+
+// Forgets the positions that were updated longest ago
+func prunePositions(state *ResumeState) {
+	if len(state.Positions) <= RESUME_MAX_ENTRIES {
+		return
+	}
+	keys := make([]string, 0, len(state.Positions))
+	for key := range state.Positions {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return state.Positions[keys[i]].Updated.After(state.Positions[keys[j]].Updated)
+	})
+	for _, key := range keys[RESUME_MAX_ENTRIES:] {
+		delete(state.Positions, key)
+	}
+}
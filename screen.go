@@ -0,0 +1,330 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Code page 437 characters for bytes 0x80-0xFF, used by most .ans files
+const CP437_HIGH string = "ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ "
+
+var CP437 = []rune(CP437_HIGH)
+
+type CellStyle struct {
+	bold       bool
+	faint      bool
+	italic     bool
+	underline  bool
+	blink      bool
+	reverse    bool
+	foreground string
+	background string
+}
+
+type Cell struct {
+	char  rune
+	style CellStyle
+}
+
+// Minimal terminal emulator used to replay recorded terminal output
+type VirtualScreen struct {
+	width   int
+	height  int
+	cells   []Cell
+	cursorX int
+	cursorY int
+	savedX  int
+	savedY  int
+	style   CellStyle
+	pending string
+}
+
+func newVirtualScreen(width int, height int) *VirtualScreen {
+	screen := &VirtualScreen{width: width, height: height}
+	screen.cells = make([]Cell, width*height)
+	screen.clear(0, len(screen.cells))
+	return screen
+}
+
+func (screen *VirtualScreen) copy() *VirtualScreen {
+	screenCopy := *screen
+	screenCopy.cells = make([]Cell, len(screen.cells))
+	copy(screenCopy.cells, screen.cells)
+	return &screenCopy
+}
+
+func (screen *VirtualScreen) clear(start int, end int) {
+	start = max(start, 0)
+	end = min(end, len(screen.cells))
+	for i := start; i < end; i++ {
+		screen.cells[i] = Cell{' ', screen.style}
+	}
+}
+
+func (screen *VirtualScreen) scroll() {
+	copy(screen.cells, screen.cells[screen.width:])
+	screen.clear(screen.width*(screen.height-1), len(screen.cells))
+}
+
+func (screen *VirtualScreen) newLine() {
+	screen.cursorY++
+	if screen.cursorY >= screen.height {
+		screen.cursorY = screen.height - 1
+		screen.scroll()
+	}
+}
+
+func (screen *VirtualScreen) put(char rune) {
+	if screen.cursorX >= screen.width {
+		screen.cursorX = 0
+		screen.newLine()
+	}
+	screen.cells[screen.cursorY*screen.width+screen.cursorX] = Cell{char, screen.style}
+	screen.cursorX++
+}
+
+func (screen *VirtualScreen) moveCursor(x int, y int) {
+	screen.cursorX = min(max(x, 0), screen.width-1)
+	screen.cursorY = min(max(y, 0), screen.height-1)
+}
+
+// Applies terminal output to the screen.
+// Escape sequences split across writes are kept until the next write.
+func (screen *VirtualScreen) write(data string) {
+	data = screen.pending + data
+	screen.pending = ""
+
+	for i := 0; i < len(data); {
+		char, size := utf8.DecodeRuneInString(data[i:])
+		if char == utf8.RuneError && size == 1 {
+			// not UTF-8, interpret as code page 437
+			if data[i] >= 0x80 {
+				char = CP437[data[i]-0x80]
+			}
+		}
+
+		switch char {
+		case 27:
+			length, complete := screen.escape(data[i:])
+			if !complete {
+				screen.pending = data[i:]
+				return
+			}
+			i += length
+			continue
+		case '\r':
+			screen.cursorX = 0
+		case '\n':
+			screen.newLine()
+		case '\b':
+			screen.cursorX = max(screen.cursorX-1, 0)
+		case '\t':
+			screen.cursorX = min((screen.cursorX/8+1)*8, screen.width-1)
+		case 7, 0:
+		default:
+			if char >= 32 {
+				screen.put(char)
+			}
+		}
+		i += size
+	}
+}
+
+// Handles an escape sequence at the start of data.
+// Returns the length of the sequence and whether it is complete.
+func (screen *VirtualScreen) escape(data string) (int, bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+	switch data[1] {
+	case '[':
+	case '7':
+		screen.savedX, screen.savedY = screen.cursorX, screen.cursorY
+		return 2, true
+	case '8':
+		screen.moveCursor(screen.savedX, screen.savedY)
+		return 2, true
+	case ']':
+		// operating system command, terminated by BEL or ST
+		for i := 2; i < len(data); i++ {
+			if data[i] == 7 {
+				return i + 1, true
+			}
+			if data[i] == 27 && i+1 < len(data) && data[i+1] == '\\' {
+				return i + 2, true
+			}
+		}
+		return 0, false
+	default:
+		return 2, true
+	}
+
+	end := 2
+	for end < len(data) && (data[end] < 0x40 || data[end] > 0x7E) {
+		end++
+	}
+	if end >= len(data) {
+		return 0, false
+	}
+	params := data[2:end]
+	screen.csi(params, data[end])
+	return end + 1, true
+}
+
+func (screen *VirtualScreen) csi(params string, command byte) {
+	// private sequences like cursor visibility or mouse reporting don't change the screen
+	if strings.HasPrefix(params, "?") || strings.HasPrefix(params, "<") || strings.HasPrefix(params, ">") {
+		return
+	}
+	var values []int
+	for _, param := range strings.Split(params, ";") {
+		value, _ := strconv.Atoi(param)
+		values = append(values, value)
+	}
+	param := func(i int, fallback int) int {
+		if i >= len(values) || values[i] == 0 {
+			return fallback
+		}
+		return values[i]
+	}
+	cursor := screen.cursorY*screen.width + screen.cursorX
+
+	switch command {
+	case 'H', 'f':
+		screen.moveCursor(param(1, 1)-1, param(0, 1)-1)
+	case 'A':
+		screen.moveCursor(screen.cursorX, screen.cursorY-param(0, 1))
+	case 'B':
+		screen.moveCursor(screen.cursorX, screen.cursorY+param(0, 1))
+	case 'C':
+		screen.moveCursor(screen.cursorX+param(0, 1), screen.cursorY)
+	case 'D':
+		screen.moveCursor(screen.cursorX-param(0, 1), screen.cursorY)
+	case 'G':
+		screen.moveCursor(param(0, 1)-1, screen.cursorY)
+	case 'd':
+		screen.moveCursor(screen.cursorX, param(0, 1)-1)
+	case 'J':
+		switch param(0, 0) {
+		case 0:
+			screen.clear(cursor, len(screen.cells))
+		case 1:
+			screen.clear(0, cursor+1)
+		default:
+			screen.clear(0, len(screen.cells))
+		}
+	case 'K':
+		lineStart := screen.cursorY * screen.width
+		switch param(0, 0) {
+		case 0:
+			screen.clear(cursor, lineStart+screen.width)
+		case 1:
+			screen.clear(lineStart, cursor+1)
+		default:
+			screen.clear(lineStart, lineStart+screen.width)
+		}
+	case 's':
+		screen.savedX, screen.savedY = screen.cursorX, screen.cursorY
+	case 'u':
+		screen.moveCursor(screen.savedX, screen.savedY)
+	case 'm':
+		screen.style = applySgr(screen.style, params)
+	}
+}
+
+// Applies Select Graphic Rendition parameters to a style
+func applySgr(style CellStyle, params string) CellStyle {
+	values := strings.Split(params, ";")
+	for i := 0; i < len(values); i++ {
+		value, _ := strconv.Atoi(values[i])
+		switch {
+		case value == 0:
+			style = CellStyle{}
+		case value == 1:
+			style.bold = true
+		case value == 2:
+			style.faint = true
+		case value == 3:
+			style.italic = true
+		case value == 4:
+			style.underline = true
+		case value == 5:
+			style.blink = true
+		case value == 7:
+			style.reverse = true
+		case value == 22:
+			style.bold, style.faint = false, false
+		case value == 23:
+			style.italic = false
+		case value == 24:
+			style.underline = false
+		case value == 25:
+			style.blink = false
+		case value == 27:
+			style.reverse = false
+		case value >= 30 && value <= 37, value >= 90 && value <= 97:
+			style.foreground = values[i]
+		case value == 39:
+			style.foreground = ""
+		case value >= 40 && value <= 47, value >= 100 && value <= 107:
+			style.background = values[i]
+		case value == 49:
+			style.background = ""
+		case value == 38 || value == 48:
+			// extended colors: 5;n or 2;r;g;b
+			length := 0
+			if i+1 < len(values) && values[i+1] == "5" {
+				length = 2
+			} else if i+1 < len(values) && values[i+1] == "2" {
+				length = 4
+			}
+			if length == 0 || i+length >= len(values) {
+				return style
+			}
+			color := strings.Join(values[i:i+length+1], ";")
+			if value == 38 {
+				style.foreground = color
+			} else {
+				style.background = color
+			}
+			i += length
+		}
+	}
+	return style
+}
+
+// Escape sequence that sets the style from a reset state
+func (style CellStyle) escape() string {
+	params := []string{"0"}
+	flags := []bool{style.bold, style.faint, style.italic, style.underline, style.blink, false, style.reverse}
+	for i, enabled := range flags {
+		if enabled {
+			params = append(params, strconv.Itoa(i+1))
+		}
+	}
+	if style.foreground != "" {
+		params = append(params, style.foreground)
+	}
+	if style.background != "" {
+		params = append(params, style.background)
+	}
+	return "\033[" + strings.Join(params, ";") + "m"
+}
+
+// Renders a row of the screen with escape sequences, cropped to width characters
+func (screen *VirtualScreen) renderRow(row int, width int) string {
+	var line strings.Builder
+	var style CellStyle
+	line.WriteString(RESET_COLOR)
+	for col := 0; col < min(width, screen.width); col++ {
+		cell := screen.cells[row*screen.width+col]
+		if cell.style != style {
+			line.WriteString(cell.style.escape())
+			style = cell.style
+		}
+		line.WriteRune(cell.char)
+	}
+	line.WriteString(RESET_COLOR)
+	return line.String()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// The characters of every row, without styles
+func screenRows(screen *VirtualScreen) []string {
+	rows := make([]string, screen.height)
+	for row := range rows {
+		var line strings.Builder
+		for _, cell := range screen.cells[row*screen.width : (row+1)*screen.width] {
+			line.WriteRune(cell.char)
+		}
+		rows[row] = line.String()
+	}
+	return rows
+}
+
+func TestVirtualScreen(t *testing.T) {
+	filled := "abcde\r\nfghij\r\nklmno"
+	tests := []struct {
+		name    string
+		writes  []string
+		rows    []string
+		cursorX int
+		cursorY int
+	}{
+		{"text", []string{"abc"}, []string{"abc  ", "     ", "     "}, 3, 0},
+		{"carriage return and line feed", []string{"abc\r\nde"}, []string{"abc  ", "de   ", "     "}, 2, 1},
+		{"line feed keeps the column", []string{"ab\ncd"}, []string{"ab   ", "  cd ", "     "}, 4, 1},
+		{"wrap at the end of the row", []string{"abcdefg"}, []string{"abcde", "fg   ", "     "}, 2, 1},
+		{"scroll at the bottom", []string{"a\r\nb\r\nc\r\nd"}, []string{"b    ", "c    ", "d    "}, 1, 2},
+		{"backspace", []string{"ab\bx"}, []string{"ax   ", "     ", "     "}, 2, 0},
+		{"tab", []string{"a\tb"}, []string{"a   b", "     ", "     "}, 5, 0},
+		{"code page 437", []string{"\xb0\xdb"}, []string{"░█   ", "     ", "     "}, 2, 0},
+		{"utf-8", []string{"é─"}, []string{"é─   ", "     ", "     "}, 2, 0},
+
+		{"cursor position", []string{"\033[2;3Hx"}, []string{"     ", "  x  ", "     "}, 3, 1},
+		{"cursor home", []string{"abc\033[Hx"}, []string{"xbc  ", "     ", "     "}, 1, 0},
+		{"cursor position is clamped", []string{"\033[10;10Hx"}, []string{"     ", "     ", "    x"}, 5, 2},
+		{"cursor up", []string{"\033[3;2H\033[2Ax"}, []string{" x   ", "     ", "     "}, 2, 0},
+		{"cursor down", []string{"\033[Bx"}, []string{"     ", "x    ", "     "}, 1, 1},
+		{"cursor forward", []string{"\033[3Cx"}, []string{"   x ", "     ", "     "}, 4, 0},
+		{"cursor back", []string{"abcd\033[2Dx"}, []string{"abxd ", "     ", "     "}, 3, 0},
+		{"cursor column", []string{"abc\033[2Gx"}, []string{"axc  ", "     ", "     "}, 2, 0},
+		{"cursor row", []string{"ab\033[3dx"}, []string{"ab   ", "     ", "  x  "}, 3, 2},
+		{"save and restore with ESC", []string{"ab\0337\033[3;1Hx\0338y"}, []string{"aby  ", "     ", "x    "}, 3, 0},
+		{"save and restore with CSI", []string{"ab\033[s\033[3;1Hx\033[uy"}, []string{"aby  ", "     ", "x    "}, 3, 0},
+
+		{"erase below", []string{filled, "\033[2;3H\033[J"}, []string{"abcde", "fg   ", "     "}, 2, 1},
+		{"erase above", []string{filled, "\033[2;3H\033[1J"}, []string{"     ", "   ij", "klmno"}, 2, 1},
+		{"erase screen", []string{filled, "\033[2J"}, []string{"     ", "     ", "     "}, 5, 2},
+		{"erase to the end of the line", []string{filled, "\033[2;3H\033[K"}, []string{"abcde", "fg   ", "klmno"}, 2, 1},
+		{"erase to the start of the line", []string{filled, "\033[2;3H\033[1K"}, []string{"abcde", "   ij", "klmno"}, 2, 1},
+		{"erase the line", []string{filled, "\033[2;3H\033[2K"}, []string{"abcde", "     ", "klmno"}, 2, 1},
+
+		{"private sequences are ignored", []string{"\033[?25la\033[?1049hb"}, []string{"ab   ", "     ", "     "}, 2, 0},
+		{"window title is ignored", []string{"\033]0;title\007a\033]2;title\033\\b"}, []string{"ab   ", "     ", "     "}, 2, 0},
+		{"sequence split across writes", []string{"a\033", "[2", ";1Hb"}, []string{"a    ", "b    ", "     "}, 1, 1},
+		{"window title split across writes", []string{"\033]0;ti", "tle\007a"}, []string{"a    ", "     ", "     "}, 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			screen := newVirtualScreen(5, 3)
+			for _, data := range test.writes {
+				screen.write(data)
+			}
+			rows := screenRows(screen)
+			for i := range rows {
+				if rows[i] != test.rows[i] {
+					t.Errorf("rows are %q, want %q", rows, test.rows)
+					break
+				}
+			}
+			if screen.cursorX != test.cursorX || screen.cursorY != test.cursorY {
+				t.Errorf("cursor is at %d,%d, want %d,%d", screen.cursorX, screen.cursorY, test.cursorX, test.cursorY)
+			}
+		})
+	}
+}
+
+func TestApplySgr(t *testing.T) {
+	bold := CellStyle{bold: true, foreground: "31"}
+	tests := []struct {
+		name   string
+		style  CellStyle
+		params string
+		want   CellStyle
+	}{
+		{"reset", bold, "0", CellStyle{}},
+		{"empty is a reset", bold, "", CellStyle{}},
+		{"attributes", CellStyle{}, "1;2;3;4;5;7", CellStyle{bold: true, faint: true, italic: true, underline: true, blink: true, reverse: true}},
+		{"attributes off", CellStyle{bold: true, faint: true, italic: true, underline: true, blink: true, reverse: true}, "22;23;24;25;27", CellStyle{}},
+		{"colors", CellStyle{}, "31;42", CellStyle{foreground: "31", background: "42"}},
+		{"bright colors", CellStyle{}, "91;102", CellStyle{foreground: "91", background: "102"}},
+		{"default colors", CellStyle{foreground: "31", background: "42"}, "39;49", CellStyle{}},
+		{"256 colors", CellStyle{}, "38;5;208;48;5;17", CellStyle{foreground: "38;5;208", background: "48;5;17"}},
+		{"true color", CellStyle{}, "1;38;2;10;20;30", CellStyle{bold: true, foreground: "38;2;10;20;30"}},
+		{"cut off extended color", bold, "38;5", bold},
+		{"unknown extended color", bold, "38;9;1", bold},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := applySgr(test.style, test.params); got != test.want {
+				t.Errorf("applySgr(%q) = %+v, want %+v", test.params, got, test.want)
+			}
+			// the escape sequence of a style sets the same style again
+			escape := test.want.escape()
+			if got := applySgr(CellStyle{bold: true}, escape[2:len(escape)-1]); got != test.want {
+				t.Errorf("%q sets %+v, want %+v", escape, got, test.want)
+			}
+		})
+	}
+}
+
+func TestVirtualScreenStyle(t *testing.T) {
+	screen := newVirtualScreen(5, 1)
+	screen.write("\033[1;31ma\033[0mb\033[44m\033[K")
+	want := []CellStyle{{bold: true, foreground: "31"}, {}, {background: "44"}, {background: "44"}, {background: "44"}}
+	for i, cell := range screen.cells {
+		if cell.style != want[i] {
+			t.Errorf("style of cell %d is %+v, want %+v", i, cell.style, want[i])
+		}
+	}
+	if row := screen.renderRow(0, 2); row != RESET_COLOR+"\033[0;1;31ma\033[0mb"+RESET_COLOR {
+		t.Errorf("renderRow = %q", row)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cli-video-player/media"
+)
+
+const SEEK_PROMPT_TEXT = "seek: "
+
+var SEEK_PROMPT bool = false
+var SEEK_INPUT string = ""
+var SEEK_ERROR string = ""
+
+// Parses a seek target into a frame number.
+// Accepted formats: "1:23:45", "1:23", "90s", "90", "45%" and "#1234".
+func parseSeekTarget(input string, video *Video) (int, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return 0, errors.New("empty seek target")
+	}
+
+	var frame int
+	switch {
+	case strings.HasPrefix(input, "#"):
+		value, err := strconv.Atoi(input[1:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid frame number '%s'", input)
+		}
+		frame = value
+	case strings.HasSuffix(input, "%"):
+		value, err := strconv.ParseFloat(input[:len(input)-1], 64)
+		if err != nil || value < 0 || value > 100 {
+			return 0, fmt.Errorf("invalid percentage '%s'", input)
+		}
+		if video.totalFrames == 0 {
+			return 0, errors.New("percentages need a known duration")
+		}
+		frame = int(float64(video.totalFrames) * value / 100)
+	case strings.Contains(input, ":"):
+		seconds, err := media.ParseTimestamp(input)
+		if err != nil {
+			return 0, err
+		}
+		frame = int(seconds * video.fps)
+	default:
+		value, err := strconv.ParseFloat(strings.TrimSuffix(input, "s"), 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid time '%s'", input)
+		}
+		frame = int(value * video.fps)
+	}
+
+	// the length of streams is unknown
+	if frame < 0 || (video.totalFrames > 0 && frame > video.totalFrames) {
+		return 0, fmt.Errorf("'%s' is outside of the video", input)
+	}
+	return frame, nil
+}
+
+// Handles a single key while the seek prompt is open.
+func handlePromptInput(key byte) {
+	switch {
+	case key == 13 || key == 10: // SUBMIT: enter
+		frame, err := parseSeekTarget(SEEK_INPUT, &CURRENT_VIDEO)
+		if err != nil {
+			SEEK_ERROR = err.Error()
+			return
+		}
+		closeSeekPrompt()
+		seekTo(frame)
+	case key == 27: // CANCEL: escape
+		closeSeekPrompt()
+	default:
+		SEEK_INPUT = editPromptInput(SEEK_INPUT, key)
+		SEEK_ERROR = ""
+	}
+}
+
+// Applies a typed key to the text of a prompt
+func editPromptInput(input string, key byte) string {
+	switch {
+	case key == 127 || key == 8: // DELETE: backspace
+		if len(input) > 0 {
+			return input[:len(input)-1]
+		}
+	case key == 21: // CLEAR LINE: ctrl-u
+		return ""
+	case key >= 32 && key <= 126:
+		return input + string(key)
+	}
+	return input
+}
+
+func openSeekPrompt() {
+	SEEK_PROMPT = true
+	SEEK_INPUT = ""
+	SEEK_ERROR = ""
+}
+
+func closeSeekPrompt() {
+	SEEK_PROMPT = false
+	SEEK_INPUT = ""
+	SEEK_ERROR = ""
+}
+
+func drawSeekPrompt() string {
+	prompt := YELLOW_COLOR + SEEK_PROMPT_TEXT + RESET_COLOR + SEEK_INPUT
+	if SEEK_ERROR != "" {
+		prompt += "  " + RED_COLOR + SEEK_ERROR + RESET_COLOR
+	}
+	return prompt + "\033[K"
+}
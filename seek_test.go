@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestParseSeekTarget(t *testing.T) {
+	video := &Video{fps: 30, totalFrames: 3000}
+	tests := []struct {
+		input   string
+		frame   int
+		wantErr bool
+	}{
+		{"1:23", 83 * 30, false},
+		{"0:01:40", 100 * 30, false},
+		{"90s", 90 * 30, false},
+		{"90", 90 * 30, false},
+		{"1.5", 45, false},
+		{"  10  ", 300, false},
+		{"50%", 1500, false},
+		{"100%", 3000, false},
+		{"#1234", 1234, false},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"-5", 0, true},
+		{"101%", 0, true},
+		{"#x", 0, true},
+		{"#3001", 0, true},
+		{"1:60", 0, true},
+		{"200", 0, true},
+	}
+	for _, test := range tests {
+		frame, err := parseSeekTarget(test.input, video)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseSeekTarget(%q) error = %v, want error %v", test.input, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && frame != test.frame {
+			t.Errorf("parseSeekTarget(%q) = %d, want %d", test.input, frame, test.frame)
+		}
+	}
+}
+
+func TestParseSeekTargetStream(t *testing.T) {
+	// streams have no known length, so frames past the end are accepted
+	video := &Video{fps: 25}
+	if frame, err := parseSeekTarget("1:00:00", video); err != nil || frame != 90000 {
+		t.Errorf("parseSeekTarget on a stream = %d, %v, want 90000", frame, err)
+	}
+	if _, err := parseSeekTarget("50%", video); err == nil {
+		t.Error("parseSeekTarget accepted a percentage without a known duration")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		cols    int
+		rows    int
+		wantErr bool
+	}{
+		{"80x24", 80, 24, false},
+		{"120X40", 120, 40, false},
+		{"1x4", 1, 4, false},
+		{"80", 0, 0, true},
+		{"80x", 0, 0, true},
+		{"x24", 0, 0, true},
+		{"0x24", 0, 0, true},
+		{"80x3", 0, 0, true},
+		{"axb", 0, 0, true},
+	}
+	for _, test := range tests {
+		cols, rows, err := parseSize(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseSize(%q) error = %v, want error %v", test.input, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && (cols != test.cols || rows != test.rows) {
+			t.Errorf("parseSize(%q) = %dx%d, want %dx%d", test.input, cols, rows, test.cols, test.rows)
+		}
+	}
+}
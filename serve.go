@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cli-video-player/media"
+)
+
+// Telnet commands and options used to negotiate the window size (RFC 1073)
+const (
+	TELNET_IAC  byte = 255
+	TELNET_DONT byte = 254
+	TELNET_DO   byte = 253
+	TELNET_WONT byte = 252
+	TELNET_WILL byte = 251
+	TELNET_SB   byte = 250
+	TELNET_SE   byte = 240
+	TELNET_ECHO byte = 1
+	TELNET_SGA  byte = 3
+	TELNET_NAWS byte = 31
+)
+
+const SERVE_DEFAULT_ADDRESS = ":2323"
+
+// Outputs queued per client, slower clients skip frames and get a full frame once they catch up
+const SERVE_CLIENT_QUEUE int = 8
+
+// Clients without window size negotiation (e.g. netcat) get the default terminal size
+const SERVE_DEFAULT_WIDTH int = 80
+const SERVE_DEFAULT_HEIGHT int = 24
+const SERVE_MAX_WIDTH int = 1000
+const SERVE_MAX_HEIGHT int = 500
+
+type ServeClient struct {
+	conn           net.Conn
+	width          int
+	height         int
+	needsFullFrame bool
+	output         chan string
+}
+
+// Decodes a video once and sends the rendered frames to every connected client.
+// Frames are rendered once per distinct window size.
+type Server struct {
+	video      *Video
+	clients    map[*ServeClient]bool
+	lastFrames map[[2]int]*string
+	mutex      sync.Mutex
+	writers    sync.WaitGroup
+}
+
+func runServe(args []string) {
+	flags := newFlagSet("serve")
+	address := flags.String("addr", SERVE_DEFAULT_ADDRESS, "address to listen on")
+	loop := flags.Bool("loop", false, "start over when the video ends")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return
+	}
+	if len(args) != 1 {
+		printUsageError(flags.Name(), "Expected one video to serve, got", len(args), "arguments.")
+		return
+	}
+	path := args[0]
+	video := loadServeVideo(path)
+	if video == nil {
+		return
+	}
+
+	listener, err := net.Listen("tcp", *address)
+	if err != nil {
+		printError("Could not listen on '"+*address+"':", err)
+		return
+	}
+
+	server := &Server{video: video, clients: map[*ServeClient]bool{}, lastFrames: map[[2]int]*string{}}
+	accepting := make(chan struct{})
+	go func() {
+		acceptClients(server, listener)
+		close(accepting)
+	}()
+	fmt.Println(PREFIX, "Serving '"+path+"' on "+listener.Addr().String()+", connect with 'telnet <host> <port>'.")
+
+	for {
+		if err := streamVideo(server); err != nil {
+			printError("Could not decode '"+path+"':", err)
+			break
+		}
+		if !*loop || video.stream != nil {
+			break
+		}
+	}
+	// no clients can join while the others are disconnected
+	listener.Close()
+	<-accepting
+	server.closeClients()
+	// let the clients reset their terminals before exiting
+	server.writers.Wait()
+	fmt.Println(PREFIX, "Finished serving '"+path+"'.")
+}
+
+// Loads files, generated sources and urls like the player, streams are read once
+func loadServeVideo(path string) *Video {
+	var video Video
+	if isStream(path) {
+		video = openStream(path)
+	} else {
+		if _, err := os.Stat(path); err != nil && !media.IsLavfi(path) && !media.IsUrl(path) {
+			printError("File '" + path + "' could not be found.")
+			return nil
+		}
+		video = loadVideo(path)
+		// live streams have no duration and can't be seeked with ffmpeg
+		if video.fps != 0 && video.duration == 0 && media.IsUrl(path) {
+			video = openStream(path)
+		}
+	}
+	if video.fps == 0 {
+		printError("'" + path + "' is not a valid video.")
+		return nil
+	}
+	if video.stream != nil {
+		go readStream(&video)
+	}
+	return &video
+}
+
+// Decodes the video from the start in real time, broadcasting every frame
+func streamVideo(server *Server) error {
+	video := server.video
+	frameAmount := video.totalFrames
+	if frameAmount == 0 {
+		frameAmount = math.MaxInt
+	}
+	startTime := time.Now()
+	frameNumber := 0
+	return decodeVideo(video, 0, frameAmount, func(frame Frame) bool {
+		server.broadcastFrame(&frame, frameNumber)
+		frameNumber++
+		time.Sleep(time.Until(startTime.Add(time.Duration(float64(frameNumber) / video.fps * float64(time.Second)))))
+		return true
+	})
+}
+
+func (server *Server) broadcastFrame(frame *Frame, frameNumber int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	video := server.video
+	frames := map[[2]int]*string{}
+	diffs := map[[2]int]string{}
+	for client := range server.clients {
+		size := [2]int{client.width, client.height}
+		ascii, exists := frames[size]
+		if !exists {
+			// the first row shows what is playing, the last one is left empty so the terminal doesn't scroll
+			ascii = frameToAscii(frame, video.width, video.height, CHANNELS, DEFAULT_ASCII, client.width, client.height-2)
+			frames[size] = ascii
+			if lastFrame, exists := server.lastFrames[size]; exists {
+				diffs[size] = getFrameDiffWithWidth(lastFrame, ascii, client.width)
+			}
+		}
+
+		header := gotoCharacter(0, 0) + server.header(frameNumber, client.width) + "\033[K"
+		diff, hasDiff := diffs[size]
+		var output string
+		if client.needsFullFrame || !hasDiff {
+			output = "\033[2J" + header + gotoCharacter(0, 1) + *ascii
+		} else {
+			output = header + diff
+		}
+		select {
+		case client.output <- output:
+			client.needsFullFrame = false
+		default:
+			// the client can't keep up, it continues with a full frame once its queue has room
+			client.needsFullFrame = true
+		}
+	}
+	// sizes nobody uses anymore are dropped
+	server.lastFrames = frames
+}
+
+// Shows the video name, position and amount of viewers, cut to the width of the client
+func (server *Server) header(frameNumber int, width int) string {
+	current := int(float64(frameNumber) / server.video.fps)
+	text := fmt.Sprintf("%s %s [%d:%02d", PREFIX_TEXT, filepath.Base(server.video.filepath), current/60, current%60)
+	if runtime := int(server.video.duration.Seconds()); runtime > 0 {
+		text += fmt.Sprintf("/%d:%02d", runtime/60, runtime%60)
+	}
+	text += fmt.Sprintf("]  %d watching", len(server.clients))
+	if len(text) > width {
+		text = text[:width]
+	}
+	return text
+}
+
+func acceptClients(server *Server, listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		client := &ServeClient{
+			conn:           conn,
+			width:          SERVE_DEFAULT_WIDTH,
+			height:         SERVE_DEFAULT_HEIGHT,
+			needsFullFrame: true,
+			output:         make(chan string, SERVE_CLIENT_QUEUE),
+		}
+		// ask for the window size, and take over echoing so typed keys aren't shown
+		conn.Write([]byte{
+			TELNET_IAC, TELNET_DO, TELNET_NAWS,
+			TELNET_IAC, TELNET_WILL, TELNET_ECHO,
+			TELNET_IAC, TELNET_WILL, TELNET_SGA,
+		})
+		conn.Write([]byte("\033[?25l"))
+
+		server.mutex.Lock()
+		server.clients[client] = true
+		server.mutex.Unlock()
+		server.writers.Add(1)
+		go writeClient(server, client)
+		go readClient(server, client)
+	}
+}
+
+func writeClient(server *Server, client *ServeClient) {
+	defer server.writers.Done()
+	for output := range client.output {
+		if _, err := client.conn.Write([]byte(output)); err != nil {
+			client.conn.Close()
+		}
+	}
+	client.conn.Write([]byte("\033[?25h" + RESET_COLOR + "\033[2J\033[H"))
+	client.conn.Close()
+}
+
+func readClient(server *Server, client *ServeClient) {
+	readTelnet(server, client, bufio.NewReader(client.conn))
+	server.removeClient(client)
+}
+
+// Handles telnet negotiation and keys until the client quits or disconnects
+func readTelnet(server *Server, client *ServeClient, reader *bufio.Reader) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		if b != TELNET_IAC {
+			if b == 113 || b == 3 { // EXIT: q, ctrl-c
+				return
+			}
+			continue
+		}
+		command, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		switch command {
+		case TELNET_DO, TELNET_DONT, TELNET_WILL, TELNET_WONT:
+			reader.ReadByte()
+		case TELNET_SB:
+			data, err := readSubnegotiation(reader)
+			if err == nil && len(data) >= 5 && data[0] == TELNET_NAWS {
+				width := int(data[1])<<8 | int(data[2])
+				height := int(data[3])<<8 | int(data[4])
+				server.resizeClient(client, width, height)
+			}
+		}
+	}
+}
+
+// Reads the data of a subnegotiation up to IAC SE, escaped IAC bytes are doubled
+func readSubnegotiation(reader *bufio.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b != TELNET_IAC {
+			data = append(data, b)
+			continue
+		}
+		next, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if next == TELNET_SE {
+			return data, nil
+		}
+		data = append(data, next)
+	}
+}
+
+func (server *Server) resizeClient(client *ServeClient, width int, height int) {
+	// some clients send 0 when the size is unknown
+	if width < 1 || height < 4 {
+		return
+	}
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	client.width = min(width, SERVE_MAX_WIDTH)
+	client.height = min(height, SERVE_MAX_HEIGHT)
+	client.needsFullFrame = true
+}
+
+func (server *Server) removeClient(client *ServeClient) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.clients[client] {
+		delete(server.clients, client)
+		close(client.output)
+	}
+}
+
+func (server *Server) closeClients() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	for client := range server.clients {
+		delete(server.clients, client)
+		close(client.output)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer() *Server {
+	video := &Video{filepath: "served.mp4", fps: 10, width: 8, height: 4, totalFrames: 20, duration: 2 * time.Second}
+	return &Server{video: video, clients: map[*ServeClient]bool{}, lastFrames: map[[2]int]*string{}}
+}
+
+func TestReadTelnet(t *testing.T) {
+	naws := func(data ...byte) []byte {
+		return append(append([]byte{TELNET_IAC, TELNET_SB, TELNET_NAWS}, data...), TELNET_IAC, TELNET_SE)
+	}
+	tests := []struct {
+		name   string
+		input  []byte
+		width  int
+		height int
+		rest   string
+	}{
+		{"window size", naws(0, 100, 0, 40), 100, 40, ""},
+		{"negotiation before the size", append([]byte{TELNET_IAC, TELNET_WILL, TELNET_NAWS, TELNET_IAC, TELNET_DO, TELNET_SGA}, naws(0, 90, 0, 30)...), 90, 30, ""},
+		{"escaped 255 in the width", naws(1, TELNET_IAC, TELNET_IAC, 0, 50), 511, 50, ""},
+		{"escaped 255 in the height", naws(0, 80, 0, TELNET_IAC, TELNET_IAC), 80, 255, ""},
+		{"clamped to the maximum", naws(TELNET_IAC, TELNET_IAC, TELNET_IAC, TELNET_IAC, TELNET_IAC, TELNET_IAC, TELNET_IAC, TELNET_IAC), SERVE_MAX_WIDTH, SERVE_MAX_HEIGHT, ""},
+		{"unknown size", naws(0, 0, 0, 0), SERVE_DEFAULT_WIDTH, SERVE_DEFAULT_HEIGHT, ""},
+		{"cut off subnegotiation", []byte{TELNET_IAC, TELNET_SB, TELNET_NAWS, 0, 100}, SERVE_DEFAULT_WIDTH, SERVE_DEFAULT_HEIGHT, ""},
+		{"too short", naws(0, 100, 0), SERVE_DEFAULT_WIDTH, SERVE_DEFAULT_HEIGHT, ""},
+		{"keys are ignored", append([]byte("abc"), naws(0, 70, 0, 20)...), 70, 20, ""},
+		{"q quits", append([]byte("q"), naws(0, 70, 0, 20)...), SERVE_DEFAULT_WIDTH, SERVE_DEFAULT_HEIGHT, string(naws(0, 70, 0, 20))},
+		{"ctrl-c quits", append(naws(0, 70, 0, 20), 3, 'x'), 70, 20, "x"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer()
+			client := &ServeClient{width: SERVE_DEFAULT_WIDTH, height: SERVE_DEFAULT_HEIGHT}
+			reader := bufio.NewReader(bytes.NewReader(test.input))
+			readTelnet(server, client, reader)
+			if client.width != test.width || client.height != test.height {
+				t.Errorf("size is %dx%d, want %dx%d", client.width, client.height, test.width, test.height)
+			}
+			rest := make([]byte, len(test.input))
+			n, _ := reader.Read(rest)
+			if string(rest[:n]) != test.rest {
+				t.Errorf("left %q unread, want %q", rest[:n], test.rest)
+			}
+		})
+	}
+}
+
+// Connects a client over a pipe, the returned function reads what one broadcast sent to it
+func connectTestClient(t *testing.T, server *Server) func() string {
+	t.Helper()
+	conn, remote := net.Pipe()
+	client := &ServeClient{
+		conn:           conn,
+		width:          SERVE_DEFAULT_WIDTH,
+		height:         SERVE_DEFAULT_HEIGHT,
+		needsFullFrame: true,
+		output:         make(chan string, SERVE_CLIENT_QUEUE),
+	}
+	server.mutex.Lock()
+	server.clients[client] = true
+	server.mutex.Unlock()
+	server.writers.Add(1)
+	go writeClient(server, client)
+	t.Cleanup(func() {
+		server.removeClient(client)
+		// writeClient closes the connection after resetting the terminal
+		remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := io.ReadAll(remote); err != nil {
+			t.Errorf("disconnecting: %v", err)
+		}
+	})
+
+	return func() string {
+		t.Helper()
+		remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+		// every output is a single write, which a pipe hands over in one read
+		buffer := make([]byte, 64*1024)
+		n, err := remote.Read(buffer)
+		if err != nil {
+			t.Fatalf("reading the broadcast: %v", err)
+		}
+		return string(buffer[:n])
+	}
+}
+
+func TestBroadcastFrame(t *testing.T) {
+	server := newTestServer()
+	frames := make([]Frame, 4)
+	for i := range frames {
+		frames[i] = Frame(bytes.Repeat([]byte{byte(i * 80)}, 8*4*CHANNELS))
+	}
+	isFull := func(output string) bool {
+		return strings.HasPrefix(output, "\033[2J")
+	}
+
+	readFirst := connectTestClient(t, server)
+	server.broadcastFrame(&frames[0], 0)
+	if output := readFirst(); !isFull(output) {
+		t.Errorf("the first frame of a client is a diff: %q", output)
+	}
+	server.broadcastFrame(&frames[1], 1)
+	if output := readFirst(); isFull(output) {
+		t.Error("the second frame of a client is a full frame")
+	}
+
+	// joins with the same size, so a diff to the last frame exists already
+	readLate := connectTestClient(t, server)
+	server.broadcastFrame(&frames[2], 2)
+	if output := readFirst(); isFull(output) {
+		t.Error("a client got a full frame because another one joined")
+	}
+	if output := readLate(); !isFull(output) {
+		t.Errorf("the first frame of a late joiner is a diff: %q", output)
+	}
+	server.broadcastFrame(&frames[3], 3)
+	readFirst()
+	if output := readLate(); isFull(output) {
+		t.Error("the second frame of a late joiner is a full frame")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var SNAPSHOT bool = false
+var SNAPSHOT_DIR string = "."
+var STATUS_MESSAGE string = ""
+var STATUS_MESSAGE_UNTIL time.Time
+
+// Messages from goroutines other than the play loop, see postStatusMessage
+const STATUS_MESSAGE_QUEUE int = 8
+
+var STATUS_MESSAGES = make(chan string, STATUS_MESSAGE_QUEUE)
+
+// Saves a rendered frame as .txt and .ans, and the source frame as .png.
+// Returns the path of the snapshot without extension.
+func saveSnapshot(video *Video, frameNumber int, frame *Frame, ascii *string, frameWidth int, frameHeight int, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := strings.TrimSuffix(filepath.Base(video.filepath), filepath.Ext(video.filepath))
+	timestamp := time.Duration(float64(frameNumber) / video.fps * float64(time.Second))
+	hours := int(timestamp.Hours())
+	minutes := int(timestamp.Minutes()) % 60
+	seconds := int(timestamp.Seconds()) % 60
+	milliseconds := timestamp.Milliseconds() % 1000
+	path := filepath.Join(dir, fmt.Sprintf("%s_%02d-%02d-%02d.%03d", name, hours, minutes, seconds, milliseconds))
+
+	var lines []string
+	for row := 0; row < frameHeight && (row+1)*frameWidth <= len(*ascii); row++ {
+		lines = append(lines, (*ascii)[row*frameWidth:(row+1)*frameWidth])
+	}
+
+	if err := os.WriteFile(path+".txt", []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return "", err
+	}
+	ansi := RESET_COLOR + strings.Join(lines, "\r\n") + RESET_COLOR + "\r\n"
+	if err := os.WriteFile(path+".ans", []byte(ansi), 0644); err != nil {
+		return "", err
+	}
+	if err := saveFramePng(path+".png", frame, video.width, video.height); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func saveFramePng(path string, frame *Frame, width int, height int) error {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	copy(img.Pix, (*frame)[:min(len(*frame), len(img.Pix))])
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return png.Encode(file, img)
+}
+
+// Shows a message in place of the menubar for a few seconds. Only called from the play loop,
+// other goroutines use postStatusMessage.
+func setStatusMessage(message string) {
+	STATUS_MESSAGE = message
+	STATUS_MESSAGE_UNTIL = time.Now().Add(3 * time.Second)
+}
+
+// Queues a message from another goroutine, the play loop shows it when it draws the menu.
+// Messages are dropped while the queue is full.
+func postStatusMessage(message string) {
+	select {
+	case STATUS_MESSAGES <- message:
+	default:
+	}
+}
+
+func drawStatusMessage() (string, bool) {
+	for len(STATUS_MESSAGES) > 0 {
+		setStatusMessage(<-STATUS_MESSAGES)
+	}
+	if STATUS_MESSAGE == "" || time.Now().After(STATUS_MESSAGE_UNTIL) {
+		return "", false
+	}
+	return YELLOW_COLOR + STATUS_MESSAGE + RESET_COLOR + "\033[K", true
+}
+
+func handleSnapshot(frameNumber int, frame *Frame, ascii *string) {
+	if !SNAPSHOT {
+		return
+	}
+	SNAPSHOT = false
+	path, err := saveSnapshot(&CURRENT_VIDEO, frameNumber, frame, ascii, TERMINAL_WIDTH, TERMINAL_HEIGHT-3, SNAPSHOT_DIR)
+	if err != nil {
+		setStatusMessage("Snapshot failed: " + err.Error())
+		return
+	}
+	setStatusMessage("Snapshot saved to " + path + ".{txt,ans,png}")
+}
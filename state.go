@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Directory for data the player keeps between runs, like resume positions
+func stateDir() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, CONFIG_NAME)
+}
+
+// Reads a JSON state file into value, a missing file leaves value unchanged
+func readStateFile(name string, value any) error {
+	data, err := os.ReadFile(filepath.Join(stateDir(), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Writes a JSON state file by renaming a complete temporary file over it, so other players
+// reading at the same time never see a partial file
+func writeStateFile(name string, value any) error {
+	if stateDir() == "" {
+		return errors.New("no home directory to keep state in")
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir(), 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(stateDir(), name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filepath.Join(stateDir(), name))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
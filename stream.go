@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"cli-video-player/media"
+)
+
+// Memory used for frames that were already played, these can still be seeked to
+const STREAM_RETAIN_BYTES int = 256 * 1024 * 1024
+
+// Frames decoded ahead of the current frame
+func streamReadAhead() int {
+	return BUFFER_OFFSET * 2
+}
+
+// Backend pipes and live streams are decoded with, frames are scaled to width x height when they are set
+var NEW_PIPE_DECODER = func(path string, width int, height int) media.Decoder {
+	return media.NewPipeDecoder(path, width, height)
+}
+
+// A single decoder reading a pipe from start to end.
+// Only a window of the most recent frames is kept, which limits seeking.
+type Stream struct {
+	decoder    media.Decoder
+	frames     []Frame
+	firstFrame int
+	// next frame the decoder reads, reading stays ahead of it
+	position int
+	ended    bool
+	closed   bool
+	// closed with the stream, stops waiting to reconnect
+	stop  chan struct{}
+	mutex sync.Mutex
+}
+
+// Whether the path has to be read as a stream instead of being seekable
+func isStream(path string) bool {
+	if path == "-" {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// Starts decoding a pipe or network stream, which can only be read once
+func openStream(path string) Video {
+	decoder := NEW_PIPE_DECODER(path, 0, 0)
+	info, err := decoder.Probe()
+	if err != nil {
+		decoder.Close()
+		return Video{}
+	}
+	video := videoFromMedia(&info, nil)
+	if video.fps == 0 {
+		decoder.Close()
+		return Video{}
+	}
+	video.stream = &Stream{decoder: decoder, stop: make(chan struct{})}
+	video.live = video.duration == 0 && media.IsUrl(path)
+	video.decoder = &StreamDecoder{stream: video.stream, info: info}
+	return video
+}
+
+// Reads frames from the decoder until the stream ends, staying at most streamReadAhead() frames ahead.
+// Network streams that fail are restarted with increasing delays.
+func readStream(video *Video) {
+	stream := video.stream
+	frameSize := video.width * video.height * CHANNELS
+	readAhead := streamReadAhead()
+	maxRetained := max(STREAM_RETAIN_BYTES/frameSize, readAhead*2)
+	attempt := 0
+
+	for {
+		for streamAhead(stream) > readAhead && !streamClosed(stream) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		frame, _, err := stream.decoder.ReadFrame()
+		if err != nil {
+			if err == io.EOF || !media.IsUrl(video.filepath) || attempt >= MAX_RECONNECTS || streamClosed(stream) {
+				break
+			}
+			RECONNECTING.Store(true)
+			select {
+			case <-time.After(reconnectDelay(attempt)):
+			case <-stream.stop:
+			}
+			attempt++
+			// the resolution could change after reconnecting, frames have to keep their size
+			stream.mutex.Lock()
+			// reading from a closed stream fails, which ends reading above
+			if !stream.closed {
+				stream.decoder.Close()
+				stream.decoder = NEW_PIPE_DECODER(video.filepath, video.width, video.height)
+			}
+			stream.mutex.Unlock()
+			continue
+		}
+		RECONNECTING.Store(false)
+		attempt = 0
+
+		stream.mutex.Lock()
+		stream.frames = append(stream.frames, frame)
+		// drop the oldest frames, but never the ones that still have to be played
+		for len(stream.frames) > maxRetained && stream.firstFrame < stream.position-readAhead {
+			stream.frames[0] = nil
+			stream.frames = stream.frames[1:]
+			stream.firstFrame++
+		}
+		stream.mutex.Unlock()
+	}
+	RECONNECTING.Store(false)
+
+	stream.mutex.Lock()
+	stream.ended = true
+	stream.mutex.Unlock()
+}
+
+// Frames received after the one the decoder reads next
+func streamAhead(stream *Stream) int {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	return stream.firstFrame + len(stream.frames) - stream.position
+}
+
+func streamClosed(stream *Stream) bool {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	return stream.closed
+}
+
+// Returns the range of frames that can be seeked to
+func streamWindow(video *Video) (int, int) {
+	video.stream.mutex.Lock()
+	defer video.stream.mutex.Unlock()
+	return video.stream.firstFrame, max(video.stream.firstFrame+len(video.stream.frames)-1, video.stream.firstFrame)
+}
+
+// Reads the retained frames of a stream, waiting for frames that haven't been received yet.
+// Frames that were already dropped are skipped.
+type StreamDecoder struct {
+	stream *Stream
+	info   media.MediaInfo
+}
+
+func (decoder *StreamDecoder) Probe() (media.MediaInfo, error) {
+	return decoder.info, nil
+}
+
+func (decoder *StreamDecoder) Seek(position time.Duration) error {
+	stream := decoder.stream
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	stream.position = int(math.Round(position.Seconds() * decoder.fps()))
+	return nil
+}
+
+func (decoder *StreamDecoder) ReadFrame() (media.Frame, time.Duration, error) {
+	stream := decoder.stream
+	for {
+		stream.mutex.Lock()
+		if stream.closed {
+			stream.mutex.Unlock()
+			return nil, 0, errors.New("the stream is closed")
+		}
+		frameNumber := max(stream.position, stream.firstFrame)
+		if frameNumber < stream.firstFrame+len(stream.frames) {
+			frame := stream.frames[frameNumber-stream.firstFrame]
+			stream.position = frameNumber + 1
+			stream.mutex.Unlock()
+			return frame, time.Duration(float64(frameNumber) / decoder.fps() * float64(time.Second)), nil
+		}
+		ended := stream.ended
+		stream.mutex.Unlock()
+		if ended {
+			return nil, 0, io.EOF
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Stops decoding, reading from a stream that was closed fails
+func (decoder *StreamDecoder) Close() error {
+	stream := decoder.stream
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	if !stream.closed {
+		stream.closed = true
+		close(stream.stop)
+		stream.decoder.Close()
+	}
+	return nil
+}
+
+func (decoder *StreamDecoder) fps() float64 {
+	return decoder.info.Streams[0].FrameRate.Float()
+}
+
+// Limits a frame number to the frames a video can seek to
+func clampFrame(video *Video, frame int) int {
+	first, last := seekRange(video)
+	return min(max(frame, first), last)
+}
+
+// Range of frames that can be seeked to
+func seekRange(video *Video) (int, int) {
+	if video.stream != nil {
+		return streamWindow(video)
+	}
+	return 0, video.totalFrames
+}
+
+// Opens the terminal for keyboard input, for when stdin is used for the video.
+// Returns nil when there is no terminal.
+func openTerminalInput() *os.File {
+	path := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		path = "CONIN$"
+	}
+	input, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	return input
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"cli-video-player/media"
+)
+
+func TestReadStream(t *testing.T) {
+	original := NEW_PIPE_DECODER
+	defer func() { NEW_PIPE_DECODER = original }()
+	NEW_PIPE_DECODER = func(path string, width int, height int) media.Decoder {
+		return media.NewMemoryDecoder(path, 8, 4, 10, media.PatternFrames(8, 4, 25))
+	}
+
+	video := openStream("-")
+	if video.stream == nil || video.fps != 10 || video.width != 8 || video.height != 4 {
+		t.Fatalf("openStream returned %dx%d at %v fps, want a stream of 8x4 at 10 fps", video.width, video.height, video.fps)
+	}
+	if video.live {
+		t.Error("stdin is live")
+	}
+	go readStream(&video)
+	defer video.decoder.Close()
+
+	frames := 0
+	for {
+		frame, timestamp, err := video.decoder.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if want := media.PatternFrames(8, 4, 25)[frames]; string(frame) != string(want) {
+			t.Fatalf("frame %d at %v differs from the decoded one", frames, timestamp)
+		}
+		frames++
+	}
+	if frames != 25 {
+		t.Errorf("read %d frames, want 25", frames)
+	}
+	if first, last := streamWindow(&video); first != 0 || last != 24 {
+		t.Errorf("stream can seek from %d to %d, want 0 to 24", first, last)
+	}
+}
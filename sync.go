@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Followers seek when they are further than this from the host
+const SYNC_TOLERANCE = 200 * time.Millisecond
+
+// Time between state updates from the host and clock measurements of followers
+const SYNC_INTERVAL = time.Second
+
+// Messages waiting for a peer, newer ones are dropped while it is full
+const SYNC_QUEUE int = 32
+
+// Clock measurements used for the offset, the one with the lowest round trip time wins
+const SYNC_SAMPLES int = 8
+
+// A newline delimited JSON message. Times are unix nanoseconds on the host's clock.
+// Name is the sender, shown when they pause or seek. Reverse is the playback direction
+// and Speed how fast frames advance in it, missing from players without speed control.
+type SyncMessage struct {
+	Type    string  `json:"type"` // hello, state, ping, pong
+	Name    string  `json:"name,omitempty"`
+	Frame   int     `json:"frame,omitempty"`
+	Time    int64   `json:"time,omitempty"`
+	Sent    int64   `json:"sent,omitempty"`
+	Paused  bool    `json:"paused,omitempty"`
+	Reverse bool    `json:"reverse,omitempty"`
+	Speed   float64 `json:"speed,omitempty"`
+	Seeked  bool    `json:"seeked,omitempty"`
+}
+
+type ClockSample struct {
+	offset    time.Duration
+	roundTrip time.Duration
+}
+
+// Another player in the session. Messages are written by a goroutine per peer,
+// so a stuck connection never stalls playback.
+type SyncPeer struct {
+	name   string
+	output chan []byte
+}
+
+// A watch-together session. The host decides the shared state, followers send their
+// own pauses and seeks to the host, which passes them on to everyone else.
+type SyncSession struct {
+	host    bool
+	name    string
+	conns   map[net.Conn]*SyncPeer
+	mutex   sync.Mutex
+	samples []ClockSample
+	// host clock minus local clock
+	offset time.Duration
+	// state received from the network, applied by the play loop
+	pending *SyncMessage
+	// last state that was shared, to notice local changes
+	frame      int
+	paused     bool
+	reverse    bool
+	speed      float64
+	ignoreSeek bool
+	// set for hosts, closed with the session
+	listener net.Listener
+	// closed when the session ends, stops the goroutines that send on an interval
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+var SYNC *SyncSession
+var SEEKED bool = false
+
+func defaultSyncName() string {
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	if name := os.Getenv("USERNAME"); name != "" {
+		return name
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+func hostSync(address string, name string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	session := &SyncSession{host: true, name: name, conns: map[net.Conn]*SyncPeer{}, speed: PLAYBACK.Speed(), listener: listener, stop: make(chan struct{})}
+	SYNC = session
+	session.done.Add(2)
+	go func() {
+		defer session.done.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// named once their hello arrives
+			session.addPeer(conn, "")
+			go readSyncConn(session, conn)
+		}
+	}()
+	go session.every(SYNC_INTERVAL, func() {
+		session.broadcast(session.currentState(false), nil)
+	})
+	return nil
+}
+
+func joinSync(address string, name string) error {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	session := &SyncSession{name: name, conns: map[net.Conn]*SyncPeer{}, speed: PLAYBACK.Speed(), stop: make(chan struct{})}
+	SYNC = session
+	session.addPeer(conn, "host")
+	// measure the clock first, so the state the host answers with can be used right away
+	session.send(conn, SyncMessage{Type: "ping", Sent: time.Now().UnixNano()})
+	session.send(conn, SyncMessage{Type: "hello", Name: name})
+	go readSyncConn(session, conn)
+	session.done.Add(1)
+	go session.every(SYNC_INTERVAL, func() {
+		session.send(conn, SyncMessage{Type: "ping", Sent: time.Now().UnixNano()})
+	})
+	return nil
+}
+
+// Calls send every interval until the session is closed
+func (session *SyncSession) every(interval time.Duration, send func()) {
+	defer session.done.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			send()
+		case <-session.stop:
+			return
+		}
+	}
+}
+
+// Stops listening and sending, and disconnects every peer
+func stopSync() {
+	if SYNC == nil {
+		return
+	}
+	SYNC.close()
+}
+
+func (session *SyncSession) close() {
+	close(session.stop)
+	if session.listener != nil {
+		session.listener.Close()
+	}
+	session.done.Wait()
+	// the readers notice the closed connections and remove the peers
+	for _, conn := range session.connections() {
+		conn.Close()
+	}
+}
+
+func readSyncConn(session *SyncSession, conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var message SyncMessage
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			continue
+		}
+		switch message.Type {
+		case "hello":
+			session.mutex.Lock()
+			if peer := session.conns[conn]; peer != nil {
+				peer.name = message.Name
+			}
+			session.mutex.Unlock()
+			postStatusMessage(message.Name + " joined")
+			session.send(conn, session.currentState(false))
+		case "ping":
+			session.send(conn, SyncMessage{Type: "pong", Sent: message.Sent, Time: time.Now().UnixNano()})
+		case "pong":
+			session.addClockSample(message.Sent, message.Time)
+		case "state":
+			session.mutex.Lock()
+			session.pending = &message
+			session.mutex.Unlock()
+			// the host passes changes from followers on to everyone else
+			if session.host {
+				session.broadcast(message, conn)
+			}
+		}
+	}
+
+	session.mutex.Lock()
+	peer := session.conns[conn]
+	delete(session.conns, conn)
+	// the writer closes the connection
+	close(peer.output)
+	session.mutex.Unlock()
+	if session.host {
+		if peer.name != "" {
+			postStatusMessage(peer.name + " left")
+		}
+	} else {
+		postStatusMessage("Lost the connection to the host, playing on alone")
+	}
+}
+
+// Estimates the clock offset like NTP, assuming the message took as long both ways
+func (session *SyncSession) addClockSample(sent int64, hostTime int64) {
+	now := time.Now().UnixNano()
+	roundTrip := time.Duration(now - sent)
+	offset := time.Duration(hostTime - (sent+now)/2)
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.samples = append(session.samples, ClockSample{offset, roundTrip})
+	if len(session.samples) > SYNC_SAMPLES {
+		session.samples = session.samples[1:]
+	}
+	best := session.samples[0]
+	for _, sample := range session.samples {
+		if sample.roundTrip < best.roundTrip {
+			best = sample
+		}
+	}
+	session.offset = best.offset
+}
+
+func (session *SyncSession) hostTime() int64 {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return time.Now().Add(session.offset).UnixNano()
+}
+
+func (session *SyncSession) currentState(seeked bool) SyncMessage {
+	now := session.hostTime()
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return SyncMessage{
+		Type:    "state",
+		Name:    session.name,
+		Frame:   session.frame,
+		Time:    now,
+		Paused:  session.paused,
+		Reverse: session.reverse,
+		Speed:   session.speed,
+		Seeked:  seeked,
+	}
+}
+
+func (session *SyncSession) addPeer(conn net.Conn, name string) {
+	peer := &SyncPeer{name: name, output: make(chan []byte, SYNC_QUEUE)}
+	session.mutex.Lock()
+	session.conns[conn] = peer
+	session.mutex.Unlock()
+	go writeSyncConn(conn, peer)
+}
+
+func writeSyncConn(conn net.Conn, peer *SyncPeer) {
+	for data := range peer.output {
+		conn.SetWriteDeadline(time.Now().Add(SYNC_INTERVAL))
+		if _, err := conn.Write(data); err != nil {
+			// the reader notices the closed connection and removes the peer
+			conn.Close()
+		}
+	}
+	conn.Close()
+}
+
+// Queues the message without waiting for the peer
+func (session *SyncSession) send(conn net.Conn, message SyncMessage) {
+	data, _ := json.Marshal(message)
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	peer := session.conns[conn]
+	if peer == nil {
+		return
+	}
+	select {
+	case peer.output <- append(data, '\n'):
+	default:
+		// the state is sent again every interval, a peer this far behind catches up with that
+	}
+}
+
+// Sends the message to every connection except the one it came from
+func (session *SyncSession) broadcast(message SyncMessage, from net.Conn) {
+	for _, conn := range session.connections() {
+		if conn != from {
+			session.send(conn, message)
+		}
+	}
+}
+
+// Frame the sender of the state is at right now
+func expectedFrame(session *SyncSession, state *SyncMessage) int {
+	if state.Paused {
+		return state.Frame
+	}
+	speed := state.Speed
+	if speed == 0 {
+		speed = 1
+	}
+	elapsed := time.Duration(session.hostTime() - state.Time)
+	frames := int(math.Round(elapsed.Seconds() * CURRENT_VIDEO.fps * speed))
+	if state.Reverse {
+		return state.Frame - frames
+	}
+	return state.Frame + frames
+}
+
+// Shares local pauses and seeks and applies state received from others. Runs every frame.
+func handleSync() {
+	session := SYNC
+	if session == nil {
+		return
+	}
+	seeked := SEEKED
+	SEEKED = false
+	paused, reverse, speed := PLAYBACK.Paused(), PLAYBACK.Reverse(), PLAYBACK.Speed()
+
+	session.mutex.Lock()
+	state := session.pending
+	session.pending = nil
+	session.frame = PLAYBACK.CurrentFrame()
+	if session.ignoreSeek && seeked {
+		seeked = false
+		session.ignoreSeek = false
+	}
+	changed := seeked || paused != session.paused || reverse != session.reverse || speed != session.speed
+	session.paused = paused
+	session.reverse = reverse
+	session.speed = speed
+	session.mutex.Unlock()
+
+	// local changes are newer than whatever was received
+	if changed {
+		session.broadcast(session.currentState(seeked), nil)
+		return
+	}
+	if state != nil {
+		applySyncState(session, state)
+	}
+}
+
+func applySyncState(session *SyncSession, state *SyncMessage) {
+	if state.Paused != PLAYBACK.Paused() {
+		if state.Paused {
+			setStatusMessage(state.Name + " paused")
+			PLAYBACK.Pause()
+		} else {
+			setStatusMessage(state.Name + " resumed")
+			PLAYBACK.Play()
+		}
+	}
+	PLAYBACK.SetReverse(state.Reverse)
+	if state.Speed > 0 && state.Speed != PLAYBACK.Speed() {
+		setStatusMessage(fmt.Sprintf("%s changed the speed to %gx", state.Name, state.Speed))
+		PLAYBACK.SetSpeed(state.Speed)
+	}
+
+	target := expectedFrame(session, state)
+	frame := PLAYBACK.CurrentFrame()
+	tolerance := int(SYNC_TOLERANCE.Seconds() * CURRENT_VIDEO.fps)
+	seek := target != frame && (state.Seeked || abs(target-frame) > tolerance)
+	if seek {
+		if state.Seeked {
+			seconds := int(float64(target) / CURRENT_VIDEO.fps)
+			setStatusMessage(fmt.Sprintf("%s seeked to %d:%02d", state.Name, seconds/60, seconds%60))
+		}
+		seekTo(target)
+	}
+
+	// remote changes are not shared again
+	session.mutex.Lock()
+	session.paused = state.Paused
+	session.reverse = state.Reverse
+	session.speed = PLAYBACK.Speed()
+	session.ignoreSeek = seek
+	session.mutex.Unlock()
+}
+
+func (session *SyncSession) connections() []net.Conn {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	conns := make([]net.Conn, 0, len(session.conns))
+	for conn := range session.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// Plays a 10 fps video on a timeline, for the functions that use the globals of the play loop
+func setSyncPlayback(t *testing.T, frame int) *Timeline {
+	t.Helper()
+	oldVideo, oldPlayback, oldSync := CURRENT_VIDEO, PLAYBACK, SYNC
+	t.Cleanup(func() {
+		CURRENT_VIDEO, PLAYBACK, SYNC = oldVideo, oldPlayback, oldSync
+	})
+	CURRENT_VIDEO = Video{filepath: "video.mp4", fps: 10, totalFrames: 1000, duration: 100 * time.Second}
+	timeline := newTimeline(&CURRENT_VIDEO, frame)
+	PLAYBACK = timeline
+	return timeline
+}
+
+func waitUntil(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting until " + what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncLoopback(t *testing.T) {
+	setSyncPlayback(t, 0)
+	if err := hostSync("127.0.0.1:0", "host"); err != nil {
+		t.Fatalf("hostSync: %v", err)
+	}
+	host := SYNC
+	if err := joinSync(host.listener.Addr().String(), "guest"); err != nil {
+		host.close()
+		t.Fatalf("joinSync: %v", err)
+	}
+	follower := SYNC
+
+	waitUntil(t, "the host knows the guest", func() bool {
+		host.mutex.Lock()
+		defer host.mutex.Unlock()
+		for _, peer := range host.conns {
+			if peer.name == "guest" {
+				return true
+			}
+		}
+		return false
+	})
+	// the host answers the hello with its state, after the pong of the first ping
+	waitUntil(t, "the follower received the state", func() bool {
+		follower.mutex.Lock()
+		defer follower.mutex.Unlock()
+		return follower.pending != nil && len(follower.samples) > 0
+	})
+	follower.mutex.Lock()
+	offset := follower.offset
+	follower.mutex.Unlock()
+	// both use the same clock
+	if offset < -50*time.Millisecond || offset > 50*time.Millisecond {
+		t.Errorf("clock offset to the host is %v, want about 0", offset)
+	}
+
+	follower.close()
+	host.close()
+	if conn, err := net.Dial("tcp", host.listener.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("the host still accepts connections after closing")
+	}
+	waitUntil(t, "the host dropped the guest", func() bool { return len(host.connections()) == 0 })
+	select {
+	case <-host.stop:
+	default:
+		t.Error("the stop channel is still open")
+	}
+}
+
+func TestAddClockSample(t *testing.T) {
+	session := &SyncSession{}
+	now := time.Now().UnixNano()
+	// a slow measurement, 400ms round trip with the host 1s ahead
+	session.addClockSample(now-int64(400*time.Millisecond), now-int64(200*time.Millisecond)+int64(time.Second))
+	if session.offset < 950*time.Millisecond || session.offset > 1050*time.Millisecond {
+		t.Errorf("offset is %v after one sample, want about 1s", session.offset)
+	}
+	// a fast measurement wins, even though it is older
+	now = time.Now().UnixNano()
+	session.addClockSample(now, now+int64(2*time.Second))
+	if session.offset < 1950*time.Millisecond || session.offset > 2050*time.Millisecond {
+		t.Errorf("offset is %v, want about 2s from the sample with the lowest round trip", session.offset)
+	}
+	for i := 0; i < SYNC_SAMPLES; i++ {
+		session.addClockSample(time.Now().UnixNano()-int64(time.Second), time.Now().UnixNano())
+	}
+	if len(session.samples) != SYNC_SAMPLES {
+		t.Errorf("kept %d samples, want %d", len(session.samples), SYNC_SAMPLES)
+	}
+	// the fast sample was dropped, the host answered the ones that are left right away
+	if session.offset < 450*time.Millisecond || session.offset > 550*time.Millisecond {
+		t.Errorf("offset is %v after the fast sample was dropped, want about 500ms", session.offset)
+	}
+}
+
+func TestExpectedFrame(t *testing.T) {
+	setSyncPlayback(t, 0)
+	session := &SyncSession{}
+	second := int64(time.Second)
+	tests := []struct {
+		name  string
+		state SyncMessage
+		want  int
+	}{
+		{"paused", SyncMessage{Frame: 50, Paused: true, Time: session.hostTime() - 3*second}, 50},
+		{"playing", SyncMessage{Frame: 50, Time: session.hostTime() - second}, 60},
+		{"double speed", SyncMessage{Frame: 50, Speed: 2, Time: session.hostTime() - second}, 70},
+		{"reverse", SyncMessage{Frame: 50, Reverse: true, Time: session.hostTime() - 2*second}, 30},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := expectedFrame(session, &test.state); got < test.want || got > test.want+1 {
+				t.Errorf("expectedFrame = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestApplySyncState(t *testing.T) {
+	tests := []struct {
+		name      string
+		frame     int
+		seeked    bool
+		wantFrame int
+	}{
+		// 200ms are 2 frames at 10 fps
+		{"within the tolerance", 52, false, 50},
+		{"behind the tolerance", 47, false, 47},
+		{"ahead of the tolerance", 60, false, 60},
+		{"seeked within the tolerance", 51, true, 51},
+		{"same frame", 50, true, 50},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timeline := setSyncPlayback(t, 50)
+			timeline.Pause()
+			session := &SyncSession{}
+			applySyncState(session, &SyncMessage{Name: "host", Frame: test.frame, Paused: true, Seeked: test.seeked, Time: session.hostTime()})
+			if got := timeline.CurrentFrame(); got != test.wantFrame {
+				t.Errorf("at frame %d, want %d", got, test.wantFrame)
+			}
+			// the seek came from the host, it isn't shared again
+			if session.ignoreSeek != (test.wantFrame != 50) {
+				t.Errorf("ignoreSeek is %v after moving from 50 to %d", session.ignoreSeek, test.wantFrame)
+			}
+		})
+	}
+}
@@ -10,16 +10,43 @@ import (
 const TEST_BUFFER_SIZE int = 15
 const TEST_BUFFER_OFFSET int = 30
 
+// Deterministic input used when no video is given
+const TEST_SOURCE = "lavfi:testsrc2=size=640x480:rate=30:duration=60"
+
 var TEST_VIDEO Video
 
-func runTests(filepath string) {
-	TEST_VIDEO = loadVideo(filepath, TEST_BUFFER_OFFSET*2)
+func runBench(args []string) {
+	flags := newFlagSet("bench")
+	input := flags.Bool("input", false, "print the raw bytes of keys and mouse events instead, until ctrl-c")
+	drawSeconds := flags.Int("draw", 2, "seconds of video drawn to measure the drawing speed, 0 skips it")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return
+	}
+	if *input {
+		testInput()
+		return
+	}
+	if len(args) > 1 {
+		printUsageError(flags.Name(), "Expected at most one video, got", len(args), "arguments.")
+		return
+	}
+	filepath := TEST_SOURCE
+	if len(args) == 1 {
+		filepath = args[0]
+	}
+	TEST_VIDEO = loadVideo(filepath)
+	if TEST_VIDEO.fps == 0 || TEST_VIDEO.totalFrames < TEST_BUFFER_OFFSET {
+		printError("'" + filepath + "' is not a valid video, or too short to measure.")
+		return
+	}
 	setTerminalDimensions()
-	// testBufferSpeed(&TEST_VIDEO)
+	testBufferSpeed(&TEST_VIDEO)
 	// testGaussianBlur(&TEST_VIDEO)
 	// testAspectRatio(&TEST_VIDEO)
-	testInput()
-	// testDrawSpeed(&TEST_VIDEO, 2)
+	if *drawSeconds > 0 {
+		testDrawSpeed(&TEST_VIDEO, *drawSeconds)
+	}
 }
 
 func testBufferSpeed(video *Video) {
@@ -31,7 +58,7 @@ func testBufferSpeed(video *Video) {
 }
 func testBuffer(video *Video, startFrame int, bufferOffset int) {
 	startTime := time.Now()
-	bufferVideo(video, startFrame, bufferOffset)
+	decodeFrames(video, startFrame, bufferOffset)
 	deltaTime := time.Now().Sub(startTime)
 
 	minBufferTime := time.Second * time.Duration(video.fps) / time.Duration(bufferOffset)
@@ -44,30 +71,25 @@ func testBuffer(video *Video, startFrame int, bufferOffset int) {
 	fmt.Printf("Frame: %d-%d\n", startFrame, startFrame+bufferOffset)
 	fmt.Printf("Buffertime: %d/%d ms\n", bufferTimeMillis, minBufferTimeMillis)
 	fmt.Printf(RESET_COLOR)
-	clearBuffer(video)
 }
 
 func testDrawSpeed(video *Video, durationSec int) {
-	clearBuffer(video)
-	bufferVideo(video, 1000, int(video.fps)*durationSec)
+	frames := decodeFrames(video, 1000, int(video.fps)*durationSec)
+	if len(frames) == 0 {
+		return
+	}
 
 	startTime := time.Now()
 
-	frame, _ := getFrame(video)
-	oldFrame := processFrame(frame, video.width, video.height, CHANNELS)
+	oldFrame := processFrame(&frames[0], video.width, video.height, CHANNELS)
 	printFrame(oldFrame)
-	shiftBuffer(video)
 
-	for i := 0; i < len(video.frameBuffer); i++ {
-		frame, _ := getFrame(video)
+	for i := 1; i < len(frames); i++ {
 		setTerminalDimensions()
-		newFrame := processFrame(frame, video.width, video.height, CHANNELS)
+		newFrame := processFrame(&frames[i], video.width, video.height, CHANNELS)
 		frameDiff := getFrameDiff(oldFrame, newFrame)
 		printFrame(&frameDiff)
 		oldFrame = newFrame
-
-		shiftBuffer(video)
-		video.currentFrame++
 	}
 
 	deltaTime := time.Now().Sub(startTime)
@@ -79,12 +101,10 @@ func testDrawSpeed(video *Video, durationSec int) {
 	fmt.Printf("Drawtime: %d/%dms\n", deltaTime.Milliseconds(), time.Second*time.Duration(durationSec))
 
 	fmt.Printf(RESET_COLOR)
-	clearBuffer(video)
 }
 
 func testGaussianBlur(video *Video) {
-	bufferVideo(video, video.totalFrames/9, TEST_BUFFER_OFFSET)
-	frame, _ := getFrame(video)
+	frame := &decodeFrames(video, video.totalFrames/9, TEST_BUFFER_OFFSET)[0]
 
 	blurredFrame := gaussianBlur(video.width, video.height, frame, 1, 2)
 	blurredFrame1 := gaussianBlur(video.width, video.height, frame, 2, 4)
@@ -94,13 +114,22 @@ func testGaussianBlur(video *Video) {
 }
 
 func testAspectRatio(video *Video) {
-	bufferVideo(video, video.totalFrames/9, TEST_BUFFER_OFFSET)
-	frame, _ := getFrame(video)
+	frame := &decodeFrames(video, video.totalFrames/9, TEST_BUFFER_OFFSET)[0]
 	setTerminalDimensions()
 	asciiString := processFrame(frame, video.width, video.height, 1)
 	printFrame(asciiString)
 }
 
+// Decodes the frames into memory, so measuring doesn't depend on the player
+func decodeFrames(video *Video, startFrame int, frameAmount int) []Frame {
+	var frames []Frame
+	decodeVideo(video, startFrame, frameAmount, func(frame Frame) bool {
+		frames = append(frames, frame)
+		return true
+	})
+	return frames
+}
+
 func testInput() {
 	fd := int(os.Stdin.Fd())
 
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cli-video-player/media"
+)
+
+const THUMBNAIL_INDEX_WIDTH int = 160
+const THUMBNAIL_PREVIEW_DURATION = time.Second
+
+// Most rendered thumbnails kept, the oldest ones are dropped first
+const THUMBNAIL_CACHE_LIMIT int = 256
+
+type Thumbnail struct {
+	timestamp time.Duration
+	frame     Frame
+	width     int
+	height    int
+}
+
+type ThumbnailIndex struct {
+	filepath   string
+	thumbnails []Thumbnail
+	mutex      sync.Mutex
+	complete   bool
+}
+
+var THUMBNAIL_INDEX ThumbnailIndex
+var THUMBNAIL_CACHE = map[time.Duration]*string{}
+var THUMBNAIL_CACHE_ORDER []time.Duration
+var THUMBNAIL_CACHE_MUTEX sync.Mutex
+var THUMBNAIL_CACHE_WIDTH int
+var THUMBNAIL_CACHE_HEIGHT int
+
+// Target of the thumbnail preview, -1 when no preview should be shown
+var PREVIEW_FRAME int = -1
+var PREVIEW_UNTIL time.Time
+var PREVIEW_VISIBLE bool = false
+
+// Backend the thumbnail index is decoded with, frames are scaled to width x height
+var NEW_THUMBNAIL_DECODER = func(path string, width int, height int) media.Decoder {
+	return media.NewKeyframeDecoder(path, width, height)
+}
+
+// Decodes every keyframe of the video at path at a low resolution in the background.
+// Takes the size of the video by value, since the play loop can replace the video meanwhile.
+func buildThumbnailIndex(path string, videoWidth int, videoHeight int, index *ThumbnailIndex) {
+	width := THUMBNAIL_INDEX_WIDTH
+	height := THUMBNAIL_INDEX_WIDTH * videoHeight / videoWidth
+	height -= height % 2
+	if height < 2 {
+		height = 2
+	}
+	indexThumbnails(NEW_THUMBNAIL_DECODER(path, width, height), path, index)
+}
+
+// Adds every frame of the decoder to the index, until another video is indexed.
+// The index is complete once the decoder reached the end.
+func indexThumbnails(decoder media.Decoder, path string, index *ThumbnailIndex) {
+	defer decoder.Close()
+	resetThumbnailIndex(index, path)
+	info, err := decoder.Probe()
+	stream := media.PlayedStream(&info)
+	if err != nil || stream == nil {
+		return
+	}
+	for {
+		frame, timestamp, err := decoder.ReadFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+		index.mutex.Lock()
+		// another video was loaded in the meantime
+		if index.filepath != path {
+			index.mutex.Unlock()
+			return
+		}
+		index.thumbnails = append(index.thumbnails, Thumbnail{timestamp, frame, stream.Width, stream.Height})
+		index.mutex.Unlock()
+	}
+
+	index.mutex.Lock()
+	if index.filepath == path {
+		index.complete = true
+	}
+	index.mutex.Unlock()
+}
+
+// Empties the index and the rendered thumbnails, for when another video is loaded
+func resetThumbnailIndex(index *ThumbnailIndex, path string) {
+	index.mutex.Lock()
+	index.filepath = path
+	index.thumbnails = nil
+	index.complete = false
+	index.mutex.Unlock()
+
+	THUMBNAIL_CACHE_MUTEX.Lock()
+	THUMBNAIL_CACHE = map[time.Duration]*string{}
+	THUMBNAIL_CACHE_ORDER = nil
+	THUMBNAIL_CACHE_MUTEX.Unlock()
+}
+
+// Returns the closest indexed keyframe at or before the timestamp.
+// Thumbnails are never modified after they are indexed, so the copy can be used without the lock.
+func getThumbnail(index *ThumbnailIndex, timestamp time.Duration) (Thumbnail, bool) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if len(index.thumbnails) == 0 {
+		return Thumbnail{}, false
+	}
+	i := sort.Search(len(index.thumbnails), func(i int) bool {
+		return index.thumbnails[i].timestamp > timestamp
+	})
+	if i > 0 {
+		i--
+	}
+	return index.thumbnails[i], true
+}
+
+// Returns the last keyframe at or before the frame of the video, once the index got past it
+func keyframeBefore(index *ThumbnailIndex, video *Video, frame int) (int, bool) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if index.filepath != video.filepath {
+		return 0, false
+	}
+	i := sort.Search(len(index.thumbnails), func(i int) bool {
+		return int(math.Round(index.thumbnails[i].timestamp.Seconds()*video.fps)) > frame
+	})
+	if i == 0 || (i == len(index.thumbnails) && !index.complete) {
+		return 0, false
+	}
+	return int(math.Round(index.thumbnails[i-1].timestamp.Seconds() * video.fps)), true
+}
+
+// Renders a thumbnail to ASCII, cached per keyframe timestamp
+func renderThumbnail(thumbnail Thumbnail, width int, height int) *string {
+	THUMBNAIL_CACHE_MUTEX.Lock()
+	defer THUMBNAIL_CACHE_MUTEX.Unlock()
+
+	// rendered thumbnails are only valid for a single size
+	if width != THUMBNAIL_CACHE_WIDTH || height != THUMBNAIL_CACHE_HEIGHT {
+		THUMBNAIL_CACHE = map[time.Duration]*string{}
+		THUMBNAIL_CACHE_ORDER = nil
+		THUMBNAIL_CACHE_WIDTH = width
+		THUMBNAIL_CACHE_HEIGHT = height
+	}
+	if ascii, exists := THUMBNAIL_CACHE[thumbnail.timestamp]; exists {
+		return ascii
+	}
+	ascii := frameToAscii(&thumbnail.frame, thumbnail.width, thumbnail.height, 1, DEFAULT_ASCII, width, height)
+	if len(THUMBNAIL_CACHE_ORDER) >= THUMBNAIL_CACHE_LIMIT {
+		delete(THUMBNAIL_CACHE, THUMBNAIL_CACHE_ORDER[0])
+		THUMBNAIL_CACHE_ORDER = THUMBNAIL_CACHE_ORDER[1:]
+	}
+	THUMBNAIL_CACHE[thumbnail.timestamp] = ascii
+	THUMBNAIL_CACHE_ORDER = append(THUMBNAIL_CACHE_ORDER, thumbnail.timestamp)
+	return ascii
+}
+
+// Shows a preview of the frame for the duration, or until hidden when duration is 0
+func showPreview(frame int, duration time.Duration) {
+	if frame < 0 {
+		frame = 0
+	}
+	if frame > CURRENT_VIDEO.totalFrames {
+		frame = CURRENT_VIDEO.totalFrames
+	}
+	PREVIEW_FRAME = frame
+	PREVIEW_UNTIL = time.Time{}
+	if duration > 0 {
+		PREVIEW_UNTIL = time.Now().Add(duration)
+	}
+}
+
+func hidePreview() {
+	PREVIEW_FRAME = -1
+}
+
+// Draws the thumbnail popup above the progress bar.
+// Returns false when there is nothing to draw.
+func drawPreview() (string, bool) {
+	if PREVIEW_FRAME < 0 || (!PREVIEW_UNTIL.IsZero() && time.Now().After(PREVIEW_UNTIL)) {
+		return "", false
+	}
+	timestamp := time.Duration(float64(PREVIEW_FRAME) / CURRENT_VIDEO.fps * float64(time.Second))
+	thumbnail, exists := getThumbnail(&THUMBNAIL_INDEX, timestamp)
+	if !exists {
+		return "", false
+	}
+
+	// characters are roughly twice as high as they are wide
+	width := min(max(TERMINAL_WIDTH/4, 16), thumbnail.width, TERMINAL_WIDTH-2)
+	height := min(width*thumbnail.height/thumbnail.width/2, thumbnail.height, TERMINAL_HEIGHT-6)
+	if width < 4 || height < 2 {
+		return "", false
+	}
+	ascii := *renderThumbnail(thumbnail, width, height)
+
+	// center the popup above the previewed position on the progress bar
+	var progress float64 = float64(PREVIEW_FRAME) / float64(CURRENT_VIDEO.totalFrames)
+	center := 1 + int(float64(TERMINAL_WIDTH-2)*progress)
+	left := min(max(center-width/2-1, 0), TERMINAL_WIDTH-width-2)
+	top := TERMINAL_HEIGHT - 3 - height
+
+	seconds := int(timestamp.Seconds())
+	label := fmt.Sprintf("[%d:%02d]", seconds/60, seconds%60)
+	if len(label) > width {
+		label = ""
+	}
+
+	popup := gotoCharacter(left+1, top-1) + BLUE_COLOR + "┌" + CYAN_COLOR + label + BLUE_COLOR + strings.Repeat("─", width-len(label)) + "┐"
+	for row := 0; row < height; row++ {
+		popup += gotoCharacter(left+1, top+row) + "│" + RESET_COLOR + ascii[row*width:(row+1)*width] + BLUE_COLOR + "│"
+	}
+	popup += gotoCharacter(left+1, top+height) + "└" + strings.Repeat("─", width) + "┘" + RESET_COLOR
+	return popup, true
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"cli-video-player/media"
+)
+
+func TestIndexThumbnails(t *testing.T) {
+	var index ThumbnailIndex
+	indexThumbnails(media.NewMemoryDecoder("video.mp4", 8, 4, 2, media.PatternFrames(8, 4, 3)), "video.mp4", &index)
+	if !index.complete {
+		t.Error("the index isn't complete after reading every frame")
+	}
+	want := []time.Duration{0, 500 * time.Millisecond, time.Second}
+	if len(index.thumbnails) != len(want) {
+		t.Fatalf("indexed %d thumbnails, want %d", len(index.thumbnails), len(want))
+	}
+	for i, thumbnail := range index.thumbnails {
+		if thumbnail.timestamp != want[i] || thumbnail.width != 8 || thumbnail.height != 4 {
+			t.Errorf("thumbnail %d is %dx%d at %v, want 8x4 at %v", i, thumbnail.width, thumbnail.height, thumbnail.timestamp, want[i])
+		}
+	}
+	if thumbnail, ok := getThumbnail(&index, 700*time.Millisecond); !ok || thumbnail.timestamp != 500*time.Millisecond {
+		t.Errorf("closest thumbnail before 700ms is at %v, want 500ms", thumbnail.timestamp)
+	}
+
+	// a broken decoder leaves the index incomplete
+	indexThumbnails(&brokenDecoder{media.NewMemoryDecoder("broken.mp4", 8, 4, 2, media.PatternFrames(8, 4, 3)), 1}, "broken.mp4", &index)
+	if index.complete || len(index.thumbnails) != 1 || index.filepath != "broken.mp4" {
+		t.Errorf("index of a broken video is complete: %v with %d thumbnails of '%s', want 1 thumbnail of 'broken.mp4'", index.complete, len(index.thumbnails), index.filepath)
+	}
+}
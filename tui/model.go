@@ -0,0 +1,174 @@
+// Package tui embeds video playback in Bubble Tea programs. The Model draws into a region of
+// the parent's view and never touches the terminal itself.
+package tui
+
+import (
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"cli-video-player/player"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var lastId int64
+
+// Ticks at this rate when the frame rate of the video is unknown
+const DEFAULT_FRAME_RATE float64 = 30
+
+// Messages the Model responds to, send them with Update or return them from a tea.Cmd
+type PlayMsg struct{}
+type PauseMsg struct{}
+type TogglePauseMsg struct{}
+
+// Jumps to Position from the start of the video
+type SeekMsg struct {
+	Position time.Duration
+}
+
+// Jumps Offset from the current position, negative offsets go back
+type SkipMsg struct {
+	Offset time.Duration
+}
+
+// Sent at the frame rate of the video to redraw the Model with the given id
+type TickMsg struct {
+	id  int
+	tag int
+}
+
+// A playback event of the Model with the given id, like the end of the video
+type EventMsg struct {
+	Id    int
+	Event player.Event
+}
+
+type Model struct {
+	id     int
+	tag    int
+	player *player.Player
+	width  int
+	height int
+}
+
+// Opens the video at path to be drawn with width x height characters
+func New(path string, width int, height int) (Model, error) {
+	videoPlayer, err := player.Open(path, player.Options{Cols: width, Rows: height})
+	if err != nil {
+		return Model{}, err
+	}
+	return NewFromPlayer(videoPlayer, width, height), nil
+}
+
+// Wraps a player that was opened without an output, for example to use another renderer
+func NewFromPlayer(videoPlayer *player.Player, width int, height int) Model {
+	model := Model{
+		id:     int(atomic.AddInt64(&lastId, 1)),
+		player: videoPlayer,
+	}
+	model.SetSize(width, height)
+	return model
+}
+
+func (model Model) Id() int {
+	return model.id
+}
+
+func (model Model) Player() *player.Player {
+	return model.player
+}
+
+func (model *Model) SetSize(width int, height int) {
+	model.width = max(width, 1)
+	model.height = max(height, 1)
+	model.player.SetSize(model.width, model.height)
+}
+
+// Starts playback, ticking and waiting for events
+func (model Model) Init() tea.Cmd {
+	return tea.Batch(func() tea.Msg { return PlayMsg{} }, model.tick(), model.waitForEvent())
+}
+
+func (model Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case PlayMsg:
+		model.player.Play()
+	case PauseMsg:
+		model.player.Pause()
+	case TogglePauseMsg:
+		if model.player.Paused() || !model.player.Playing() {
+			model.player.Play()
+		} else {
+			model.player.Pause()
+		}
+	case SeekMsg:
+		model.player.Seek(msg.Position)
+	case SkipMsg:
+		model.player.Seek(model.player.Position() + msg.Offset)
+	case TickMsg:
+		// ticks of other models, or of an older tick loop of this one
+		if msg.id != model.id || msg.tag != model.tag || model.player.Closed() {
+			return model, nil
+		}
+		model.tag++
+		return model, model.tick()
+	case EventMsg:
+		if msg.Id != model.id {
+			return model, nil
+		}
+		return model, model.waitForEvent()
+	}
+	return model, nil
+}
+
+// The current frame, exactly width x height characters
+func (model Model) View() string {
+	lines := strings.Split(model.player.View(), "\n")
+	var view strings.Builder
+	for row := 0; row < model.height; row++ {
+		line := ""
+		if row < len(lines) {
+			line = lines[row]
+		}
+		if len(line) > model.width {
+			line = line[:model.width]
+		}
+		if row > 0 {
+			view.WriteByte('\n')
+		}
+		view.WriteString(line + strings.Repeat(" ", model.width-len(line)))
+	}
+	return view.String()
+}
+
+// Stops playback, the model doesn't tick anymore afterwards
+func (model Model) Close() error {
+	return model.player.Close()
+}
+
+func (model Model) tick() tea.Cmd {
+	id, tag := model.id, model.tag
+	return tea.Tick(frameInterval(model.player.FrameRate()), func(time.Time) tea.Msg {
+		return TickMsg{id: id, tag: tag}
+	})
+}
+
+func frameInterval(fps float64) time.Duration {
+	if fps <= 0 || math.IsInf(fps, 0) || math.IsNaN(fps) {
+		fps = DEFAULT_FRAME_RATE
+	}
+	return time.Duration(float64(time.Second) / fps)
+}
+
+func (model Model) waitForEvent() tea.Cmd {
+	id, events := model.id, model.player.Events()
+	return func() tea.Msg {
+		event, ok := <-events
+		if !ok {
+			return nil
+		}
+		return EventMsg{Id: id, Event: event}
+	}
+}
@@ -0,0 +1,114 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cli-video-player/media"
+	"cli-video-player/player"
+)
+
+func openMemoryModel(t *testing.T, width int, height int) Model {
+	t.Helper()
+	decoder := media.NewMemoryDecoder("memory", 8, 4, 25, media.PatternFrames(8, 4, 50))
+	videoPlayer, err := player.OpenDecoder(decoder, player.Options{Cols: 8, Rows: 4})
+	if err != nil {
+		t.Fatalf("OpenDecoder: %v", err)
+	}
+	model := NewFromPlayer(videoPlayer, width, height)
+	t.Cleanup(func() { model.Close() })
+	return model
+}
+
+// Waits until the player drew its first frame
+func waitForView(t *testing.T, videoPlayer *player.Player) string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if view := videoPlayer.View(); view != "" {
+			return view
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("no frame was drawn")
+	return ""
+}
+
+func TestView(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		height int
+	}{
+		{"padded", 12, 6},
+		{"clipped", 5, 2},
+		{"same size", 8, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			model := openMemoryModel(t, test.width, test.height)
+			// the player draws at 8x4 regardless of the size of the model
+			model.Player().SetSize(8, 4)
+			model.Player().Play()
+			model.Player().Pause()
+			frameLines := strings.Split(waitForView(t, model.Player()), "\n")
+
+			lines := strings.Split(model.View(), "\n")
+			if len(lines) != test.height {
+				t.Fatalf("View has %d lines, want %d", len(lines), test.height)
+			}
+			for row, line := range lines {
+				if len(line) != test.width {
+					t.Errorf("line %d is %d characters wide, want %d", row, len(line), test.width)
+				}
+				want := ""
+				if row < len(frameLines) {
+					want = frameLines[row][:min(len(frameLines[row]), test.width)]
+				}
+				if strings.TrimRight(line, " ") != strings.TrimRight(want, " ") {
+					t.Errorf("line %d is %q, want %q", row, line, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStaleTick(t *testing.T) {
+	model := openMemoryModel(t, 8, 4)
+	other := openMemoryModel(t, 8, 4)
+	tick := TickMsg{id: model.id, tag: model.tag}
+
+	if _, cmd := model.Update(TickMsg{id: other.id, tag: model.tag}); cmd != nil {
+		t.Error("a tick of another model was answered")
+	}
+	updated, cmd := model.Update(tick)
+	if cmd == nil {
+		t.Fatal("the current tick did not schedule the next one")
+	}
+	if updated.tag != model.tag+1 {
+		t.Errorf("tag is %d after a tick, want %d", updated.tag, model.tag+1)
+	}
+	if _, cmd := updated.Update(tick); cmd != nil {
+		t.Error("a tick of an older tick loop was answered")
+	}
+	if _, cmd := updated.Update(TickMsg{id: model.id, tag: updated.tag}); cmd == nil {
+		t.Error("the next tick did not schedule another one")
+	}
+}
+
+func TestFrameInterval(t *testing.T) {
+	tests := []struct {
+		fps  float64
+		want time.Duration
+	}{
+		{25, 40 * time.Millisecond},
+		{0, time.Second / 30},
+		{-1, time.Second / 30},
+	}
+	for _, test := range tests {
+		if got := frameInterval(test.fps); got != test.want {
+			t.Errorf("frameInterval(%v) = %v, want %v", test.fps, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cli-video-player/media"
+)
+
+// Fails after the first frames were read, like a file that is cut off
+type brokenDecoder struct {
+	*media.MemoryDecoder
+	frames int
+}
+
+var errBroken = errors.New("broken frame")
+
+func (decoder *brokenDecoder) ReadFrame() (media.Frame, time.Duration, error) {
+	if decoder.frames == 0 {
+		return nil, 0, errBroken
+	}
+	decoder.frames--
+	return decoder.MemoryDecoder.ReadFrame()
+}
+
+func requireFfmpeg(t *testing.T) {
+	t.Helper()
+	for _, command := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(command); err != nil {
+			t.Skip(command + " is not installed")
+		}
+	}
+}
+
+// Encodes two seconds of a test pattern into dir with the extra ffmpeg arguments
+func encodeTestVideo(t *testing.T, dir string, name string, args ...string) {
+	t.Helper()
+	command := []string{"-loglevel", "error", "-f", "lavfi", "-i", "testsrc=size=64x48:rate=10:duration=2", "-c:v", "mpeg4"}
+	command = append(command, args...)
+	command = append(command, filepath.Join(dir, name))
+	if output, err := exec.Command("ffmpeg", command...).CombinedOutput(); err != nil {
+		t.Fatalf("encoding %s: %v\n%s", name, err, output)
+	}
+}
+
+func decodeAll(t *testing.T, video *Video) (int, error) {
+	t.Helper()
+	decoded := 0
+	err := decodeVideo(video, 0, video.totalFrames, func(frame Frame) bool {
+		if len(frame) != video.width*video.height*CHANNELS {
+			t.Fatalf("frame %d has %d bytes, want %d", decoded, len(frame), video.width*video.height*CHANNELS)
+		}
+		decoded++
+		return true
+	})
+	return decoded, err
+}
+
+func TestDecodeVideoError(t *testing.T) {
+	decoder := &brokenDecoder{media.NewMemoryDecoder("broken", 8, 4, 10, media.PatternFrames(8, 4, 20)), 5}
+	info, _ := decoder.Probe()
+	video := videoFromMedia(&info, decoder)
+	defer decoder.Close()
+
+	decoded, err := decodeAll(t, &video)
+	if !errors.Is(err, errBroken) {
+		t.Fatalf("decodeVideo returned %v, want %v", err, errBroken)
+	}
+	if decoded != 5 {
+		t.Errorf("decoded %d frames before the error, want 5", decoded)
+	}
+}
+
+func TestDecodeVideoHttp(t *testing.T) {
+	requireFfmpeg(t)
+	dir := t.TempDir()
+	encodeTestVideo(t, dir, "video.mp4")
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	video := loadVideo(server.URL + "/video.mp4")
+	if video.fps != 10 || video.totalFrames != 20 {
+		t.Fatalf("loaded %v fps and %d frames, want 10 fps and 20 frames", video.fps, video.totalFrames)
+	}
+	defer video.decoder.Close()
+	decoded, err := decodeAll(t, &video)
+	if err != nil {
+		t.Fatalf("decodeVideo: %v", err)
+	}
+	if decoded != video.totalFrames {
+		t.Errorf("decoded %d frames, want %d", decoded, video.totalFrames)
+	}
+	if RECONNECTING.Load() {
+		t.Error("still reconnecting after decoding")
+	}
+}
+
+func TestDecodeVideoHls(t *testing.T) {
+	requireFfmpeg(t)
+	dir := t.TempDir()
+	encodeTestVideo(t, dir, "index.m3u8", "-f", "hls", "-hls_time", "0.5", "-hls_list_size", "0")
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	video := loadVideo(server.URL + "/index.m3u8")
+	if video.fps == 0 || video.totalFrames == 0 {
+		t.Fatal("the playlist could not be loaded")
+	}
+	defer video.decoder.Close()
+	decoded, err := decodeAll(t, &video)
+	if err != nil {
+		t.Fatalf("decodeVideo: %v", err)
+	}
+	// segment boundaries can shift the duration by a frame
+	if decoded < video.totalFrames-1 {
+		t.Errorf("decoded %d frames, want %d", decoded, video.totalFrames)
+	}
+}
+
+func TestDecodeVideoHttpMissing(t *testing.T) {
+	requireFfmpeg(t)
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	video := loadVideo(server.URL + "/video.mp4")
+	if video.fps != 0 {
+		t.Errorf("loaded a video that doesn't exist")
+	}
+}
+
+func TestKeyframeBefore(t *testing.T) {
+	video := &Video{filepath: "keyframes.mp4", fps: 10, width: 64, height: 48, totalFrames: 1000}
+	index := &THUMBNAIL_INDEX
+	resetThumbnailIndex(index, video.filepath)
+	defer resetThumbnailIndex(index, "")
+	// a keyframe every 12 seconds
+	for _, second := range []int{0, 12, 24} {
+		index.thumbnails = append(index.thumbnails, Thumbnail{timestamp: time.Duration(second) * time.Second})
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		frame    int
+		complete bool
+		want     int
+		exists   bool
+	}{
+		{"keyframe before", video.filepath, 200, false, 120, true},
+		{"on a keyframe", video.filepath, 120, false, 120, true},
+		{"unknown after the last indexed keyframe", video.filepath, 300, false, 0, false},
+		{"after the last keyframe", video.filepath, 300, true, 240, true},
+		{"another video", "other.mp4", 200, true, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			index.complete = test.complete
+			other := *video
+			other.filepath = test.path
+			got, exists := keyframeBefore(index, &other, test.frame)
+			if got != test.want || exists != test.exists {
+				t.Errorf("keyframeBefore(%d) = %d, %v, want %d, %v", test.frame, got, exists, test.want, test.exists)
+			}
+		})
+	}
+}